@@ -4,8 +4,11 @@ import (
 	"fmt"     // 导入格式化输出包
 	"log"     // 导入日志记录包
 	"strings" // 导入字符串处理包
+	"sync"    // 导入同步原语包
 	"time"    // 导入时间处理包
 
+	"mygodblab/internal/config" // 导入配置包
+
 	"tinygo.org/x/bluetooth" // 导入TinyGo蓝牙库
 )
 
@@ -15,26 +18,72 @@ type BluetoothAdapter struct {
 	device         *bluetooth.Device              // 连接的蓝牙设备指针（改为指针类型）
 	connected      bool                           // 连接状态标志
 	serviceUUID    bluetooth.UUID                 // DG-LAB服务UUID
-	charUUID       bluetooth.UUID                 // DG-LAB特征UUID
+	writeUUID      bluetooth.UUID                 // 写入特征UUID
+	notifyUUID     bluetooth.UUID                 // 通知特征UUID
+	batteryService bluetooth.UUID                 // 电量服务UUID
+	batteryUUID    bluetooth.UUID                 // 电量特征UUID
 	characteristic bluetooth.DeviceCharacteristic // 设备特征实例
+	batteryChar    bluetooth.DeviceCharacteristic // 电量特征实例
+	batteryFound   bool                           // 是否发现电量特征
+	battery        int                            // 最近一次读取到的电量
+	notifications  chan []byte                    // 设备通知消息通道
+	batteryUpdates chan int                       // 电量变化通道
+	address        string                         // 上次连接的设备MAC地址，重连时优先匹配
+	logFrames      bool                           // 是否记录每一帧发送的数据（调试用）
+	mu             sync.Mutex                     // 保护连接状态
 }
 
-// NewBluetoothAdapter 创建新的蓝牙适配器实例
-func NewBluetoothAdapter() *BluetoothAdapter {
-	// DG-LAB V3协议的正确UUID（根据官方文档）
-	serviceUUID, _ := bluetooth.ParseUUID("0000180c-0000-1000-8000-00805f9b34fb") // 解析DG-LAB主服务UUID (0x180C)
-	charUUID, _ := bluetooth.ParseUUID("0000150a-0000-1000-8000-00805f9b34fb")    // 解析写入特征UUID (0x150A)
+// NewBluetoothAdapter 根据蓝牙配置创建新的蓝牙适配器实例
+func NewBluetoothAdapter(cfg config.BluetoothConfig) (*BluetoothAdapter, error) {
+	// DG-LAB V3协议的UUID从配置读取，便于适配不同固件或兼容设备
+	serviceUUID, err := bluetooth.ParseUUID(cfg.ServiceUUID) // 解析DG-LAB主服务UUID (默认0x180C)
+	if err != nil {
+		return nil, fmt.Errorf("无效的服务UUID %q: %w", cfg.ServiceUUID, err)
+	}
+	writeUUID, err := bluetooth.ParseUUID(cfg.WriteUUID) // 解析写入特征UUID (默认0x150A)
+	if err != nil {
+		return nil, fmt.Errorf("无效的写特性UUID %q: %w", cfg.WriteUUID, err)
+	}
+	notifyUUID, err := bluetooth.ParseUUID(cfg.NotifyUUID) // 解析通知特征UUID (默认0x150B)
+	if err != nil {
+		return nil, fmt.Errorf("无效的通知特性UUID %q: %w", cfg.NotifyUUID, err)
+	}
+	batteryService, err := bluetooth.ParseUUID(cfg.BatteryServiceUUID) // 解析电量服务UUID (默认0x180A)
+	if err != nil {
+		return nil, fmt.Errorf("无效的电量服务UUID %q: %w", cfg.BatteryServiceUUID, err)
+	}
+	batteryUUID, err := bluetooth.ParseUUID(cfg.BatteryUUID) // 解析电量特征UUID (默认0x1500)
+	if err != nil {
+		return nil, fmt.Errorf("无效的电量特性UUID %q: %w", cfg.BatteryUUID, err)
+	}
 
 	return &BluetoothAdapter{ // 返回新的蓝牙适配器实例
-		adapter:     bluetooth.DefaultAdapter, // 使用默认蓝牙适配器
-		serviceUUID: serviceUUID,              // 设置服务UUID
-		charUUID:    charUUID,                 // 设置特征UUID
-	}
+		adapter:        bluetooth.DefaultAdapter, // 使用默认蓝牙适配器
+		serviceUUID:    serviceUUID,              // 设置服务UUID
+		writeUUID:      writeUUID,                // 设置写入特征UUID
+		notifyUUID:     notifyUUID,               // 设置通知特征UUID
+		batteryService: batteryService,           // 设置电量服务UUID
+		batteryUUID:    batteryUUID,              // 设置电量特征UUID
+		notifications:  make(chan []byte, 16),    // 创建通知消息通道
+		batteryUpdates: make(chan int, 4),        // 创建电量变化通道
+		logFrames:      cfg.LogFrames,            // 播放循环每100ms写入一帧，默认不记录
+	}, nil
 }
 
 // Enable 启用蓝牙适配器
 func (ba *BluetoothAdapter) Enable() error {
-	log.Println("启用蓝牙适配器...")  // 记录启用开始日志
+	log.Println("启用蓝牙适配器...") // 记录启用开始日志
+
+	// 监听连接断开事件，必须在Connect之前设置
+	ba.adapter.SetConnectHandler(func(device bluetooth.Address, connected bool) {
+		ba.mu.Lock()
+		defer ba.mu.Unlock()
+		if !connected && device.String() == ba.address && ba.connected {
+			log.Printf("设备连接已断开: %s", device.String())
+			ba.connected = false
+		}
+	})
+
 	err := ba.adapter.Enable() // 调用适配器启用方法 这是bluetooth.Adapter 蓝牙库里面的启用方法
 	if err != nil {            // 检查是否有错误
 		return fmt.Errorf("启用蓝牙失败: %w", err) // 返回格式化错误信息
@@ -51,6 +100,16 @@ func (ba *BluetoothAdapter) ScanAndConnect(timeout time.Duration, deviceNames []
 	var targetDevice bluetooth.ScanResult // 声明目标设备变量  //蓝牙库里面的扫描对象
 	found := false                        // 初始化找到标志为false
 
+	ba.mu.Lock()
+	lastAddress := ba.address // 曾经连接过的设备地址，重连时只连接同一台设备
+	ba.mu.Unlock()
+
+	// 超时后停止扫描
+	timer := time.AfterFunc(timeout, func() {
+		ba.adapter.StopScan()
+	})
+	defer timer.Stop()
+
 	// 扫描设备
 	err := ba.adapter.Scan(func(adapter *bluetooth.Adapter, result bluetooth.ScanResult) {
 		deviceName := result.LocalName()
@@ -64,6 +123,16 @@ func (ba *BluetoothAdapter) ScanAndConnect(timeout time.Duration, deviceNames []
 		// 检查是否是目标设备
 		//TODO:NOTICE 寻找deviceName 其设备名和 deviceNames[index]的要一样 （deviceNames[index]是目标设备 deviceName是找到的设备）
 
+		if lastAddress != "" { // 重连时按MAC地址匹配
+			if result.Address.String() == lastAddress {
+				log.Printf("找到上次连接的设备: %s", lastAddress)
+				targetDevice = result
+				found = true
+				ba.adapter.StopScan()
+			}
+			return
+		}
+
 		for _, name := range deviceNames { // 遍历目标设备名称列表
 			if strings.Contains(strings.ToLower(deviceName), strings.ToLower(name)) { // 不区分大小写比较设备名称
 				log.Printf("找到目标设备: %s", deviceName) // 记录找到目标设备日志
@@ -94,7 +163,18 @@ func (ba *BluetoothAdapter) ScanAndConnect(timeout time.Duration, deviceNames []
 		return fmt.Errorf("连接设备失败: %w", err) // 返回格式化错误信息
 	}
 
-	ba.device = device    // 保存设备实例
+	// 连接之后的任一步骤失败都要断开，否则设备一直被占用，下次扫描不到
+	ready := false
+	defer func() {
+		if !ready {
+			ba.Disconnect()
+		}
+	}()
+
+	ba.mu.Lock()
+	ba.device = device                         // 保存设备实例
+	ba.address = targetDevice.Address.String() // 记住设备地址用于重连
+	ba.mu.Unlock()
 	log.Println("设备连接成功") // 记录连接成功日志
 
 	//TODO:NOTICE 发现DG-LAB主服务 (0x180C)
@@ -107,7 +187,7 @@ func (ba *BluetoothAdapter) ScanAndConnect(timeout time.Duration, deviceNames []
 	}
 
 	if len(services) == 0 { // 检查是否找到服务
-		return fmt.Errorf("未找到DG-LAB服务 (0x180C)") // 返回未找到服务错误
+		return fmt.Errorf("未找到DG-LAB服务 (%s)", ba.serviceUUID.String()) // 返回未找到服务错误
 	}
 
 	service := services[0]                                // 获取第一个（也是唯一的）服务
@@ -136,18 +216,19 @@ func (ba *BluetoothAdapter) ScanAndConnect(timeout time.Duration, deviceNames []
 	for _, char := range characteristics { // 遍历所有特征
 		//在这个主机里面特征只有两个 写/通知
 		//遍历 一下 如果不符合写入肯定就是通知 如果符合写入就是就写入
-		charUUIDStr := char.UUID().String()   // 获取特征UUID字符串
+		charUUID := char.UUID()               // 获取特征UUID
+		charUUIDStr := charUUID.String()      // 获取特征UUID字符串
 		log.Printf("特征UUID: %s", charUUIDStr) // 记录特征UUID
 
-		// 写入特征 (0x150A)
-		if charUUIDStr == "0000150a-0000-1000-8000-00805f9b34fb" { // 检查是否是写入特征
+		// 写入特征 (默认0x150A)
+		if charUUID == ba.writeUUID { // 检查是否是写入特征
 			writeChar = char                      // 保存写入特征
 			writeCharFound = true                 // 设置找到标志
 			log.Printf("找到写入特征: %s", charUUIDStr) // 记录找到写入特征日志
 		}
 
-		// 通知特征 (0x150B)
-		if charUUIDStr == "0000150b-0000-1000-8000-00805f9b34fb" { // 检查是否是通知特征
+		// 通知特征 (默认0x150B)
+		if charUUID == ba.notifyUUID { // 检查是否是通知特征
 			notifyChar = char                     // 保存通知特征
 			notifyCharFound = true                // 设置找到标志
 			log.Printf("找到通知特征: %s", charUUIDStr) // 记录找到通知特征日志
@@ -155,7 +236,7 @@ func (ba *BluetoothAdapter) ScanAndConnect(timeout time.Duration, deviceNames []
 	}
 
 	if !writeCharFound { // 检查是否找到写入特征
-		return fmt.Errorf("未找到写入特征 (0x150A)") // 返回未找到写入特征错误
+		return fmt.Errorf("未找到写入特征 (%s)", ba.writeUUID.String()) // 返回未找到写入特征错误
 	}
 
 	ba.characteristic = writeChar // 保存写入特征实例
@@ -163,7 +244,13 @@ func (ba *BluetoothAdapter) ScanAndConnect(timeout time.Duration, deviceNames []
 	// 如果找到通知特征，启用通知
 	if notifyCharFound { // 检查是否找到通知特征
 		err = notifyChar.EnableNotifications(func(buf []byte) { // 启用通知并设置回调函数
-			log.Printf("收到设备通知: %x", buf) // 记录收到的通知数据（十六进制格式）
+			msg := make([]byte, len(buf)) // 复制数据，回调返回后底层缓冲区可能被复用
+			copy(msg, buf)
+			select {
+			case ba.notifications <- msg: // 转发给控制器处理
+			default:
+				log.Printf("通知通道已满，丢弃消息: %x", msg)
+			}
 		})
 		if err != nil { // 检查启用通知是否有错误
 			log.Printf("启用通知失败: %v", err) // 记录启用通知失败日志
@@ -172,7 +259,15 @@ func (ba *BluetoothAdapter) ScanAndConnect(timeout time.Duration, deviceNames []
 		}
 	}
 
-	ba.connected = true          // 设置连接状态为true
+	// 电量服务 (默认0x180A) 不影响主功能，发现失败只记录日志
+	if err := ba.setupBattery(device); err != nil {
+		log.Printf("电量监控不可用: %v", err)
+	}
+
+	ba.mu.Lock()
+	ba.connected = true // 设置连接状态为true
+	ba.mu.Unlock()
+	ready = true
 	log.Println("DG-LAB设备连接完成！") // 记录连接完成日志
 	return nil                   // 返回无错误
 }
@@ -180,11 +275,13 @@ func (ba *BluetoothAdapter) ScanAndConnect(timeout time.Duration, deviceNames []
 // WriteCharacteristic 写入特征值
 // TODO:NOTICE 像设备写入指令
 func (ba *BluetoothAdapter) WriteCharacteristic(data []byte) error {
-	if !ba.connected { // 检查设备是否已连接
+	if !ba.IsConnected() { // 检查设备是否已连接
 		return fmt.Errorf("设备未连接") // 返回设备未连接错误
 	}
 
-	log.Printf("发送数据: %x", data)                           // 记录发送的数据（十六进制格式）
+	if ba.logFrames {
+		log.Printf("发送数据: %x", data) // 记录发送的数据（十六进制格式）
+	}
 	_, err := ba.characteristic.WriteWithoutResponse(data) // TODO:NOTICE 开电
 	//向特征写入数据（无响应模式）
 	if err != nil { // 检查写入是否有错误
@@ -193,18 +290,126 @@ func (ba *BluetoothAdapter) WriteCharacteristic(data []byte) error {
 	return nil // 返回无错误
 }
 
+// Notifications 返回设备通知消息通道
+func (ba *BluetoothAdapter) Notifications() <-chan []byte {
+	return ba.notifications
+}
+
+// setupBattery 发现电量特征，读取初始电量并订阅电量通知
+func (ba *BluetoothAdapter) setupBattery(device *bluetooth.Device) error {
+	services, err := device.DiscoverServices([]bluetooth.UUID{ba.batteryService}) // 发现电量服务
+	if err != nil {
+		return fmt.Errorf("发现电量服务失败: %w", err)
+	}
+	if len(services) == 0 {
+		return fmt.Errorf("未找到电量服务 (%s)", ba.batteryService.String())
+	}
+
+	chars, err := services[0].DiscoverCharacteristics([]bluetooth.UUID{ba.batteryUUID}) // 发现电量特征
+	if err != nil {
+		return fmt.Errorf("发现电量特征失败: %w", err)
+	}
+	if len(chars) == 0 {
+		return fmt.Errorf("未找到电量特征 (%s)", ba.batteryUUID.String())
+	}
+	batteryChar := chars[0]
+
+	ba.mu.Lock()
+	ba.batteryChar = batteryChar
+	ba.batteryFound = true
+	ba.mu.Unlock()
+
+	// 连接时读取一次电量
+	if level, err := ba.BatteryLevel(); err == nil {
+		log.Printf("设备电量: %d%%", level)
+		ba.publishBattery(level)
+	} else {
+		log.Printf("读取电量失败: %v", err)
+	}
+
+	// 订阅电量通知，电量变化时设备主动上报
+	err = batteryChar.EnableNotifications(func(buf []byte) {
+		if len(buf) == 0 {
+			return
+		}
+		level := int(buf[0])
+		ba.mu.Lock()
+		ba.battery = level
+		ba.mu.Unlock()
+		ba.publishBattery(level)
+	})
+	if err != nil {
+		log.Printf("启用电量通知失败: %v", err)
+	} else {
+		log.Println("已启用电量通知")
+	}
+	return nil
+}
+
+// publishBattery 将电量推送给控制器，通道满时丢弃最旧的值，控制器总能收到最新电量
+func (ba *BluetoothAdapter) publishBattery(level int) {
+	for {
+		select {
+		case ba.batteryUpdates <- level:
+			return
+		default:
+		}
+		select {
+		case old := <-ba.batteryUpdates:
+			log.Printf("电量通道已满，丢弃旧电量: %d%%", old)
+		default:
+		}
+	}
+}
+
+// BatteryLevel 读取设备电量
+func (ba *BluetoothAdapter) BatteryLevel() (int, error) {
+	ba.mu.Lock()
+	found, batteryChar, cached := ba.batteryFound, ba.batteryChar, ba.battery
+	ba.mu.Unlock()
+
+	if !found {
+		return 0, fmt.Errorf("未发现电量特性")
+	}
+
+	buf := make([]byte, 1)
+	n, err := batteryChar.Read(buf) // 电量特征为1字节百分比，在锁外读取避免阻塞断开回调
+	if err != nil {
+		return cached, fmt.Errorf("读取电量失败: %w", err)
+	}
+	if n < 1 {
+		return cached, fmt.Errorf("电量数据为空")
+	}
+
+	ba.mu.Lock()
+	ba.battery = int(buf[0])
+	ba.mu.Unlock()
+	return int(buf[0]), nil
+}
+
+// BatteryUpdates 返回电量变化通道
+func (ba *BluetoothAdapter) BatteryUpdates() <-chan int {
+	return ba.batteryUpdates
+}
+
 // IsConnected 检查连接状态
 func (ba *BluetoothAdapter) IsConnected() bool {
+	ba.mu.Lock()
+	defer ba.mu.Unlock()
 	return ba.connected // 返回当前连接状态
 }
 
 // Disconnect 断开连接
 func (ba *BluetoothAdapter) Disconnect() error {
-	if ba.device != nil && ba.connected { // 检查设备是否存在且已连接
-		err := ba.device.Disconnect() // 断开设备连接
-		ba.connected = false          // 设置连接状态为false
-		ba.device = nil               // 清空设备实例
-		return err                    // 返回断开连接的结果
+	ba.mu.Lock()
+	device := ba.device     // 取出设备实例（链路丢失后也需要释放设备）
+	ba.connected = false    // 设置连接状态为false
+	ba.device = nil         // 清空设备实例
+	ba.batteryFound = false // 重连后需要重新发现电量特征
+	ba.mu.Unlock()
+
+	if device != nil { // 检查设备是否存在
+		return device.Disconnect() // 断开设备连接，在锁外调用以免与断开回调互相等待
 	}
 	return nil // 如果设备未连接，返回无错误
 }
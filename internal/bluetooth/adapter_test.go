@@ -0,0 +1,18 @@
+package bluetooth
+
+import "testing"
+
+func TestPublishBatteryKeepsLatest(t *testing.T) {
+	ba := &BluetoothAdapter{batteryUpdates: make(chan int, 4)}
+	for level := 100; level > 94; level-- {
+		ba.publishBattery(level)
+	}
+
+	// 通道容量为4，最早的两条被丢弃
+	want := []int{98, 97, 96, 95}
+	for _, w := range want {
+		if got := <-ba.batteryUpdates; got != w {
+			t.Errorf("电量 = %d, want %d", got, w)
+		}
+	}
+}
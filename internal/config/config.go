@@ -1,16 +1,34 @@
 package config
 
 import (
+	"fmt"
 	"io/ioutil"
+	"regexp"
 
 	"gopkg.in/yaml.v3"
 )
 
+// uuidPattern 128位UUID格式，如 0000180C-0000-1000-8000-00805f9b34fb
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
 // Config 应用配置结构
 type Config struct {
+	Transport TransportConfig `yaml:"transport"`
 	Bluetooth BluetoothConfig `yaml:"bluetooth"`
 	Channels  ChannelConfig   `yaml:"channels"`
 	Pulses    PulseConfig     `yaml:"pulses"`
+	Battery   BatteryConfig   `yaml:"battery"`
+	Ramp      RampConfig      `yaml:"ramp"`
+	Lease     LeaseConfig     `yaml:"lease"`
+	Session   SessionConfig   `yaml:"session"`
+	Policy    PolicyConfig    `yaml:"policy"`
+	MCP       MCPConfig       `yaml:"mcp"`
+	Scenes    SceneConfig     `yaml:"scenes"`
+}
+
+// TransportConfig 传输层配置
+type TransportConfig struct {
+	Type string `yaml:"type"` // 传输层类型: bluetooth(真实设备) 或 simulator(模拟设备)
 }
 
 // BluetoothConfig 蓝牙配置
@@ -21,6 +39,21 @@ type BluetoothConfig struct {
 	WriteUUID   string   `yaml:"write_uuid"`   // 写特性UUID
 	NotifyUUID  string   `yaml:"notify_uuid"`  // 通知特性UUID
 	BatteryUUID string   `yaml:"battery_uuid"` // 电量特性UUID
+
+	BatteryServiceUUID string `yaml:"battery_service_uuid"` // 电量服务UUID
+
+	LogFrames bool `yaml:"log_frames"` // 记录每一帧发送的数据，用于调试协议
+
+	Reconnect ReconnectConfig `yaml:"reconnect"` // 断线重连设置
+}
+
+// ReconnectConfig 断线重连配置
+type ReconnectConfig struct {
+	Enabled         bool `yaml:"enabled"`          // 是否自动重连
+	InitialBackoff  int  `yaml:"initial_backoff"`  // 首次重连等待时间(秒)
+	MaxBackoff      int  `yaml:"max_backoff"`      // 最长重连等待时间(秒)
+	NotifyTimeout   int  `yaml:"notify_timeout"`   // 等待设备回应超时判定断线(秒)
+	RestoreStrength bool `yaml:"restore_strength"` // 重连后是否恢复断线前的强度(默认从0开始)
 }
 
 // ChannelConfig 通道配置
@@ -31,9 +64,68 @@ type ChannelConfig struct {
 
 // ChannelSettings 单个通道设置
 type ChannelSettings struct {
-	Enabled         bool `yaml:"enabled"`          // 是否启用
-	MaxStrength     int  `yaml:"max_strength"`     // 最大强度
-	DefaultStrength int  `yaml:"default_strength"` // 默认强度
+	Enabled          bool `yaml:"enabled"`           // 是否启用
+	MaxStrength      int  `yaml:"max_strength"`      // 最大强度
+	DefaultStrength  int  `yaml:"default_strength"`  // 默认强度
+	FrequencyBalance int  `yaml:"frequency_balance"` // 波形频率平衡参数(0-255)，通过BF指令写入设备
+	IntensityBalance int  `yaml:"intensity_balance"` // 波形强度平衡参数(0-255)，通过BF指令写入设备
+
+	Slew SlewConfig `yaml:"slew"` // 强度变化速率限制
+}
+
+// SlewConfig 强度变化速率限制，数值为0表示不限制
+type SlewConfig struct {
+	MaxDeltaPerSecond    int    `yaml:"max_delta_per_second"`    // 每秒最多提升的强度
+	MaxCommandsPerSecond int    `yaml:"max_commands_per_second"` // 每个客户端每秒最多的强度指令数
+	Mode                 string `yaml:"mode"`                    // 超出速率时: clamp(按允许值执行并说明) 或 reject(拒绝)
+}
+
+// BatteryConfig 电量监控配置
+type BatteryConfig struct {
+	LowThreshold      int    `yaml:"low_threshold"`      // 低电量阈值(%)，低于该值触发低电量事件
+	LowAction         string `yaml:"low_action"`         // 低电量时的动作: none(仅记录) 或 cap(限制强度)
+	LowStrengthCap    int    `yaml:"low_strength_cap"`   // low_action为cap时允许的最大强度
+	CriticalThreshold int    `yaml:"critical_threshold"` // 电量即将耗尽阈值(%)
+	CriticalAction    string `yaml:"critical_action"`    // 电量即将耗尽时的动作: none(仅记录) 或 stop(停止输出)
+}
+
+// RampConfig 强度渐变配置
+type RampConfig struct {
+	AutoDelta int    `yaml:"auto_delta"` // set_strength向上跳变超过该值时自动渐变，0表示不自动渐变
+	AutoRate  int    `yaml:"auto_rate"`  // 自动渐变的速率(强度/秒)
+	AutoCurve string `yaml:"auto_curve"` // 自动渐变的曲线: linear、ease-in 或 exponential
+}
+
+// LeaseConfig 控制租约（死人开关）配置
+type LeaseConfig struct {
+	DefaultTTL int `yaml:"default_ttl"` // 未指定时的续约窗口(秒)
+	MaxTTL     int `yaml:"max_ttl"`     // 允许的最长续约窗口(秒)
+	RampDown   int `yaml:"ramp_down"`   // 租约过期后渐变归零的时间(秒)，0表示立即归零
+}
+
+// SessionConfig 输出时长限制配置，时长为0表示不限制
+type SessionConfig struct {
+	MaxContinuous int `yaml:"max_continuous"` // 最长连续输出时间(分钟)
+	MaxDaily      int `yaml:"max_daily"`      // 每日累计输出上限(分钟)
+	Cooldown      int `yaml:"cooldown"`       // 达到连续输出上限后的强制冷却时间(分钟)
+	RampDown      int `yaml:"ramp_down"`      // 达到限制或自动关闭时渐变归零的时间(秒)
+}
+
+// PolicyConfig 安全策略配置
+type PolicyConfig struct {
+	ConfigPath   string `yaml:"config_path"`   // 策略规则文件路径
+	ConfirmAbove int    `yaml:"confirm_above"` // 舒适阈值，提升到超过该强度时需要用户确认，0表示不需要
+}
+
+// MCPConfig MCP服务配置
+type MCPConfig struct {
+	ElicitationTimeout int    `yaml:"elicitation_timeout"` // 等待用户确认的时间(秒)，超时视为拒绝
+	PromptsPath        string `yaml:"prompts_path"`        // 提示模板文件路径，不存在时不提供提示模板
+}
+
+// SceneConfig 场景配置
+type SceneConfig struct {
+	ConfigPath string `yaml:"config_path"` // 场景文件路径，不存在时在首次保存场景时创建
 }
 
 // PulseConfig 波形配置
@@ -50,18 +142,173 @@ func LoadConfig(filename string) (*Config, error) {
 		return nil, err
 	}
 
-	var config Config
-	err = yaml.Unmarshal(data, &config)
+	// 以默认配置为基础，文件中未出现的字段保持默认值
+	config := DefaultConfig()
+	err = yaml.Unmarshal(data, config)
 	if err != nil {
 		return nil, err
 	}
 
-	return &config, nil
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// Validate 校验配置是否有效
+func (c *Config) Validate() error {
+	if err := c.Bluetooth.Validate(); err != nil {
+		return err
+	}
+	if err := c.Channels.AChannel.Validate("a_channel"); err != nil {
+		return err
+	}
+	if err := c.Channels.BChannel.Validate("b_channel"); err != nil {
+		return err
+	}
+	if err := c.Battery.Validate(); err != nil {
+		return err
+	}
+	if err := c.Ramp.Validate(); err != nil {
+		return err
+	}
+	if err := c.Lease.Validate(); err != nil {
+		return err
+	}
+	if err := c.Session.Validate(); err != nil {
+		return err
+	}
+	if err := c.Policy.Validate(); err != nil {
+		return err
+	}
+	return c.MCP.Validate()
+}
+
+// Validate 校验单个通道设置
+func (s *ChannelSettings) Validate(name string) error {
+	if s.MaxStrength < 0 || s.MaxStrength > 200 {
+		return fmt.Errorf("channels.%s.max_strength 必须在0-200之间: %d", name, s.MaxStrength)
+	}
+	if s.FrequencyBalance < 0 || s.FrequencyBalance > 255 {
+		return fmt.Errorf("channels.%s.frequency_balance 必须在0-255之间: %d", name, s.FrequencyBalance)
+	}
+	if s.IntensityBalance < 0 || s.IntensityBalance > 255 {
+		return fmt.Errorf("channels.%s.intensity_balance 必须在0-255之间: %d", name, s.IntensityBalance)
+	}
+	if s.Slew.MaxDeltaPerSecond < 0 || s.Slew.MaxCommandsPerSecond < 0 {
+		return fmt.Errorf("channels.%s.slew 中的速率不能为负数", name)
+	}
+	switch s.Slew.Mode {
+	case "clamp", "reject":
+	default:
+		return fmt.Errorf("channels.%s.slew.mode 只能是 clamp 或 reject: %q", name, s.Slew.Mode)
+	}
+	return nil
+}
+
+// Validate 校验电量监控配置
+func (b *BatteryConfig) Validate() error {
+	switch b.LowAction {
+	case "none", "cap":
+	default:
+		return fmt.Errorf("battery.low_action 只能是 none 或 cap: %q", b.LowAction)
+	}
+	switch b.CriticalAction {
+	case "none", "stop":
+	default:
+		return fmt.Errorf("battery.critical_action 只能是 none 或 stop: %q", b.CriticalAction)
+	}
+	if b.CriticalThreshold > b.LowThreshold {
+		return fmt.Errorf("battery.critical_threshold(%d) 不能大于 low_threshold(%d)", b.CriticalThreshold, b.LowThreshold)
+	}
+	return nil
+}
+
+// Validate 校验渐变配置
+func (r *RampConfig) Validate() error {
+	if r.AutoDelta < 0 {
+		return fmt.Errorf("ramp.auto_delta 不能为负数: %d", r.AutoDelta)
+	}
+	if r.AutoRate <= 0 {
+		return fmt.Errorf("ramp.auto_rate 必须大于0: %d", r.AutoRate)
+	}
+	switch r.AutoCurve {
+	case "linear", "ease-in", "exponential":
+	default:
+		return fmt.Errorf("ramp.auto_curve 只能是 linear、ease-in 或 exponential: %q", r.AutoCurve)
+	}
+	return nil
+}
+
+// Validate 校验控制租约配置
+func (l *LeaseConfig) Validate() error {
+	if l.DefaultTTL <= 0 || l.MaxTTL < l.DefaultTTL {
+		return fmt.Errorf("lease.default_ttl(%d) 必须大于0且不超过 max_ttl(%d)", l.DefaultTTL, l.MaxTTL)
+	}
+	if l.RampDown < 0 {
+		return fmt.Errorf("lease.ramp_down 不能为负数: %d", l.RampDown)
+	}
+	return nil
+}
+
+// Validate 校验输出时长限制配置
+func (s *SessionConfig) Validate() error {
+	if s.MaxContinuous < 0 || s.MaxDaily < 0 || s.Cooldown < 0 || s.RampDown < 0 {
+		return fmt.Errorf("session 中的时长不能为负数")
+	}
+	if s.MaxDaily > 0 && s.MaxContinuous > s.MaxDaily {
+		return fmt.Errorf("session.max_continuous(%d) 不能大于 max_daily(%d)", s.MaxContinuous, s.MaxDaily)
+	}
+	return nil
+}
+
+// Validate 校验策略配置
+func (p *PolicyConfig) Validate() error {
+	if p.ConfirmAbove < 0 || p.ConfirmAbove > 200 {
+		return fmt.Errorf("policy.confirm_above 必须在0-200之间: %d", p.ConfirmAbove)
+	}
+	return nil
+}
+
+// Validate 校验MCP服务配置
+func (m *MCPConfig) Validate() error {
+	if m.ElicitationTimeout <= 0 {
+		return fmt.Errorf("mcp.elicitation_timeout 必须大于0: %d", m.ElicitationTimeout)
+	}
+	return nil
+}
+
+// Validate 校验蓝牙配置：UUID必须是完整的128位格式，扫描超时必须为正数
+func (b *BluetoothConfig) Validate() error {
+	uuids := []struct {
+		name  string
+		value string
+	}{
+		{"service_uuid", b.ServiceUUID},
+		{"write_uuid", b.WriteUUID},
+		{"notify_uuid", b.NotifyUUID},
+		{"battery_uuid", b.BatteryUUID},
+		{"battery_service_uuid", b.BatteryServiceUUID},
+	}
+	for _, u := range uuids {
+		if !uuidPattern.MatchString(u.value) {
+			return fmt.Errorf("bluetooth.%s 不是有效的128位UUID: %q", u.name, u.value)
+		}
+	}
+
+	if b.ScanTimeout <= 0 {
+		return fmt.Errorf("bluetooth.scan_timeout 必须大于0: %d", b.ScanTimeout)
+	}
+	return nil
 }
 
 // DefaultConfig 返回默认配置
 func DefaultConfig() *Config {
 	return &Config{
+		Transport: TransportConfig{
+			Type: "bluetooth",
+		},
 		Bluetooth: BluetoothConfig{
 			ScanTimeout: 30,
 			DeviceNames: []string{"47L121000", "47L120100"},
@@ -69,17 +316,37 @@ func DefaultConfig() *Config {
 			WriteUUID:   "0000150A-0000-1000-8000-00805f9b34fb",
 			NotifyUUID:  "0000150B-0000-1000-8000-00805f9b34fb",
 			BatteryUUID: "00001500-0000-1000-8000-00805f9b34fb",
+
+			BatteryServiceUUID: "0000180A-0000-1000-8000-00805f9b34fb",
+			Reconnect: ReconnectConfig{
+				Enabled:         true,
+				InitialBackoff:  1,
+				MaxBackoff:      60,
+				NotifyTimeout:   5,
+				RestoreStrength: false,
+			},
 		},
+		// 速率限制默认关闭，推荐值见 config.yaml
 		Channels: ChannelConfig{
 			AChannel: ChannelSettings{
-				Enabled:         true,
-				MaxStrength:     100,
-				DefaultStrength: 0,
+				Enabled:          true,
+				MaxStrength:      100,
+				DefaultStrength:  0,
+				FrequencyBalance: 160,
+				IntensityBalance: 0,
+				Slew: SlewConfig{
+					Mode: "clamp",
+				},
 			},
 			BChannel: ChannelSettings{
-				Enabled:         false,
-				MaxStrength:     100,
-				DefaultStrength: 0,
+				Enabled:          false,
+				MaxStrength:      100,
+				DefaultStrength:  0,
+				FrequencyBalance: 160,
+				IntensityBalance: 0,
+				Slew: SlewConfig{
+					Mode: "clamp",
+				},
 			},
 		},
 		Pulses: PulseConfig{
@@ -87,5 +354,37 @@ func DefaultConfig() *Config {
 			DefaultPulse:   "d6f83af0",
 			UpdateInterval: 100,
 		},
+		Battery: BatteryConfig{
+			LowThreshold:      20,
+			LowAction:         "none",
+			LowStrengthCap:    30,
+			CriticalThreshold: 5,
+			CriticalAction:    "stop",
+		},
+		Ramp: RampConfig{
+			AutoDelta: 20,
+			AutoRate:  20,
+			AutoCurve: "linear",
+		},
+		Lease: LeaseConfig{
+			DefaultTTL: 30,
+			MaxTTL:     300,
+			RampDown:   3,
+		},
+		Policy: PolicyConfig{
+			ConfigPath:   "policy.yaml",
+			ConfirmAbove: 80,
+		},
+		// 输出时长限制默认关闭，推荐值见 config.yaml
+		Session: SessionConfig{
+			RampDown: 5,
+		},
+		MCP: MCPConfig{
+			ElicitationTimeout: 60,
+			PromptsPath:        "prompts.yaml",
+		},
+		Scenes: SceneConfig{
+			ConfigPath: "scenes.yaml",
+		},
 	}
 }
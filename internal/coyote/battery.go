@@ -0,0 +1,93 @@
+package coyote
+
+// batteryState 电量等级
+type batteryState int
+
+const (
+	batteryNormal   batteryState = iota // 电量正常
+	batteryLow                          // 低电量
+	batteryCritical                     // 电量即将耗尽
+)
+
+// noStrengthCap 表示没有因电量限制强度
+const noStrengthCap = -1
+
+// handleBatteryUpdates 接收传输层上报的电量，直到控制器关闭
+func (c *Controller) handleBatteryUpdates() {
+	updates := c.transport.BatteryUpdates()
+	for {
+		select {
+		case <-c.stopCh:
+			return
+		case level := <-updates:
+			c.updateBattery(level)
+		}
+	}
+}
+
+// updateBattery 更新电量并根据阈值执行低电量动作
+func (c *Controller) updateBattery(level int) {
+	cfg := c.config.Battery
+
+	c.mu.Lock()
+	c.channelState.BatteryLevel = level
+	c.stateChanged()
+
+	state := batteryNormal
+	switch {
+	case level <= cfg.CriticalThreshold:
+		state = batteryCritical
+	case level <= cfg.LowThreshold:
+		state = batteryLow
+	}
+	if state == c.batteryState {
+		c.mu.Unlock()
+		return
+	}
+	c.batteryState = state
+
+	c.batteryCap = noStrengthCap
+	switch state {
+	case batteryCritical:
+		if cfg.CriticalAction == "stop" {
+			c.batteryCap = 0
+		} else if cfg.LowAction == "cap" {
+			c.batteryCap = cfg.LowStrengthCap
+		}
+	case batteryLow:
+		if cfg.LowAction == "cap" {
+			c.batteryCap = cfg.LowStrengthCap
+		}
+	}
+
+	// 当前强度超过电量限制时立即下调
+	if c.batteryCap != noStrengthCap {
+		if c.channelState.AStrength > c.batteryCap {
+			c.channelState.AStrength = c.batteryCap
+			c.pendingA = true
+		}
+		if c.channelState.BStrength > c.batteryCap {
+			c.channelState.BStrength = c.batteryCap
+			c.pendingB = true
+		}
+	}
+	strengthCap := c.batteryCap
+	c.mu.Unlock()
+
+	switch state {
+	case batteryCritical:
+		if strengthCap == 0 {
+			c.emitEvent(EventBatteryCritical, "电量%d%%，设备即将关机，已停止输出", level)
+		} else {
+			c.emitEvent(EventBatteryCritical, "电量%d%%，设备即将关机", level)
+		}
+	case batteryLow:
+		if strengthCap != noStrengthCap {
+			c.emitEvent(EventBatteryLow, "电量%d%%，强度限制为%d", level, strengthCap)
+		} else {
+			c.emitEvent(EventBatteryLow, "电量%d%%", level)
+		}
+	default:
+		c.emitEvent(EventBatteryRecovered, "电量恢复到%d%%", level)
+	}
+}
@@ -0,0 +1,62 @@
+package coyote
+
+import (
+	"log"
+
+	"mygodblab/internal/policy"
+)
+
+// SetChannelEnabled 启用或禁用通道
+// 禁用时强度立即归零，播放循环对该通道发送无效波形使设备不输出；启用后按策略复核当前强度
+func (c *Controller) SetChannelEnabled(channel string, enabled bool) error {
+	channel, err := normalizeChannel(channel)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch channel {
+	case "A":
+		c.channelState.AEnabled = enabled
+		if !enabled {
+			c.cancelRamp(channel)
+			c.cancelFires(channel)
+			c.channelState.AStrength = 0
+			c.pendingA = true
+		}
+		c.frameIndexA = 0
+	case "B":
+		c.channelState.BEnabled = enabled
+		if !enabled {
+			c.cancelRamp(channel)
+			c.cancelFires(channel)
+			c.channelState.BStrength = 0
+			c.pendingB = true
+		}
+		c.frameIndexB = 0
+	}
+	// 启用状态已经改变，复核失败时也要更新守卫状态，否则守卫仍按旧状态校验
+	err = c.reviewStrength(policy.ActionSetEnabled, channel, "")
+	c.publishGuardState()
+	c.stateChanged()
+	if err != nil {
+		return err
+	}
+
+	if enabled {
+		log.Printf("%s通道已启用", channel)
+	} else {
+		log.Printf("%s通道已禁用，强度归零", channel)
+	}
+	return nil
+}
+
+// disabledMark 状态输出中标记禁用的通道
+func disabledMark(enabled bool) string {
+	if enabled {
+		return ""
+	}
+	return " (已禁用)"
+}
@@ -4,23 +4,67 @@ import (
 	"fmt"
 	"log"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"mygodblab/internal/bluetooth" //蓝牙通信包
 	"mygodblab/internal/config"    //配置管理包
+	"mygodblab/internal/policy"    //安全策略
 	"mygodblab/internal/protocol"  //协议包
 	"mygodblab/internal/pulse"     //波形管理包
+	"mygodblab/internal/scene"     //场景存储
+	"mygodblab/internal/transport" //传输层接口
 )
 
 // Controller 郊狼设备控制器
 // Controller 郊狼设备控制器结构体，管理设备的所有功能
 type Controller struct {
-	config       *config.Config              // 应用配置信息，包含蓝牙和通道设置
-	btAdapter    *bluetooth.BluetoothAdapter // 蓝牙适配器，处理与设备的通信
-	pulseManager *pulse.Manager              // 波形管理器，管理各种电击波形模式
-	channelState *ChannelState               // 通道状态，记录A/B通道的当前状态
-	sequence     byte                        // 指令序列号(0-15)，用于标识每个指令
-	mu           sync.RWMutex                // 读写互斥锁，保护并发访问
+	config       *config.Config      // 应用配置信息，包含蓝牙和通道设置
+	transport    transport.Transport // 传输层，处理与设备的通信（蓝牙或模拟设备）
+	guard        *transport.Guard    // 包装传输层的输出守卫，transport 即为该守卫
+	pulseManager *pulse.Manager      // 波形管理器，管理各种电击波形模式
+	scenes       *scene.Store        // 已保存的场景，场景文件无法解析时为nil
+	channelState *ChannelState       // 通道状态，记录A/B通道的当前状态
+	sequence     byte                // 指令序列号(0-15)，用于标识每个指令
+	inflight     *inflightChange     // 等待设备确认的强度变更
+	mu           sync.RWMutex        // 读写互斥锁，保护并发访问
+	writeMu      sync.Mutex          // 串行化对传输层的写入
+
+	frameIndexA  int           // A通道波形播放到的帧下标
+	frameIndexB  int           // B通道波形播放到的帧下标
+	pendingA     bool          // A通道有待发送的强度变更
+	pendingB     bool          // B通道有待发送的强度变更
+	rampA        *ramp         // A通道正在进行的强度渐变
+	rampB        *ramp         // B通道正在进行的强度渐变
+	firesA       []*fire       // A通道正在生效的临时叠加
+	firesB       []*fire       // B通道正在生效的临时叠加
+	nextFireID   int           // 叠加编号计数
+	stopCh       chan struct{} // 通知播放循环退出
+	playbackDone chan struct{} // 播放循环已退出
+
+	connState           ConnectionState // 当前连接状态
+	reconnects          int             // 成功重连次数
+	lastConnErr         string          // 最近一次连接失败或断线原因
+	lostCh              chan string     // 链路丢失通知
+	writeFailures       int             // 连续写入失败次数
+	awaitingNotifySince time.Time       // 发出带序列号指令后等待回应的起始时间
+
+	events       eventBus     // 事件分发
+	batteryState batteryState // 当前电量等级
+	batteryCap   int          // 因低电量限制的最大强度，noStrengthCap表示不限制
+
+	stopped    atomic.Bool // 急停锁存标志，不加锁读写
+	stopReason string      // 急停原因
+	stoppedAt  time.Time   // 急停时间
+
+	policy      *policy.Engine                       // 安全策略，所有强度变更都经过它评估
+	guardLimits atomic.Pointer[transport.GuardState] // 输出守卫校验用的上限和启用状态快照
+	lease       *Lease                               // 当前控制租约，nil表示没有客户端持有租约
+	session     sessionState                         // 输出会话计时
+
+	slewA        slewBucket             // A通道强度提升配额
+	slewB        slewBucket             // B通道强度提升配额
+	commandTimes map[string][]time.Time // 各客户端最近的强度指令时间，用于限制指令频率
 }
 
 // ChannelState 通道状态
@@ -29,8 +73,16 @@ type ChannelState struct {
 	BStrength    int    // B通道当前强度
 	ALimit       int    // A通道强度上限
 	BLimit       int    // B通道强度上限
-	CurrentPulse string // 当前波形ID
+	APulse       string // A通道当前波形ID
+	BPulse       string // B通道当前波形ID
+	AEnabled     bool   // A通道是否启用
+	BEnabled     bool   // B通道是否启用
 	BatteryLevel int    // 电量百分比
+
+	AFrequencyBalance int // A通道波形频率平衡参数
+	BFrequencyBalance int // B通道波形频率平衡参数
+	AIntensityBalance int // A通道波形强度平衡参数
+	BIntensityBalance int // B通道波形强度平衡参数
 }
 
 // NewController 创建新的控制器实例
@@ -41,87 +93,128 @@ func NewController(cfg *config.Config) (*Controller, error) {
 		pulseManager = pulse.NewDefaultManager()
 	}
 
-	// 创建蓝牙适配器
-	btAdapter := bluetooth.NewBluetoothAdapter()
+	engine, err := loadPolicy(cfg.Policy)
+	if err != nil {
+		return nil, err
+	}
+
+	// 创建传输层
+	tr, err := newTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
 
-	// 启用蓝牙
-	err = btAdapter.Enable()
+	// 启用传输层
+	err = tr.Enable()
 	if err != nil {
-		return nil, fmt.Errorf("启用蓝牙失败: %w", err)
+		return nil, fmt.Errorf("启用传输层失败: %w", err)
 	}
 
-	return &Controller{
+	c := &Controller{
 		config:       cfg,          // 将传入的配置对象赋值给config字段，包含了所有的应用程序配置信息
-		btAdapter:    btAdapter,    // 将传入的蓝牙适配器对象赋值给btAdapter字段，用于处理蓝牙通信
+		transport:    tr,           // 将创建的传输层赋值给transport字段，用于处理与设备的通信
 		pulseManager: pulseManager, // 将传入的脉冲管理器对象赋值给pulseManager字段，用于管理波形数据
+		scenes:       loadScenes(cfg.Scenes),
 		channelState: &ChannelState{ // 创建并初始化一个新的ChannelState结构体指针
 			AStrength:    cfg.Channels.AChannel.DefaultStrength, // 从配置中获取A通道的默认强度值
 			BStrength:    cfg.Channels.BChannel.DefaultStrength, // 从配置中获取B通道的默认强度值
 			ALimit:       cfg.Channels.AChannel.MaxStrength,     // 从配置中获取A通道的最大强度限制
 			BLimit:       cfg.Channels.BChannel.MaxStrength,     // 从配置中获取B通道的最大强度限制
-			CurrentPulse: cfg.Pulses.DefaultPulse,               // 从配置中获取默认的脉冲波形名称
+			APulse:       cfg.Pulses.DefaultPulse,               // 从配置中获取A通道默认的脉冲波形名称
+			BPulse:       cfg.Pulses.DefaultPulse,               // 从配置中获取B通道默认的脉冲波形名称
+			AEnabled:     cfg.Channels.AChannel.Enabled,         // 从配置中获取A通道是否启用
+			BEnabled:     cfg.Channels.BChannel.Enabled,         // 从配置中获取B通道是否启用
 			BatteryLevel: 0,                                     // 初始化电池电量为0，后续将通过蓝牙通信获取实际电量
+
+			AFrequencyBalance: cfg.Channels.AChannel.FrequencyBalance, // 波形平衡参数在连接时通过BF指令写入设备
+			BFrequencyBalance: cfg.Channels.BChannel.FrequencyBalance,
+			AIntensityBalance: cfg.Channels.AChannel.IntensityBalance,
+			BIntensityBalance: cfg.Channels.BChannel.IntensityBalance,
 		},
-		sequence: 1, // 初始化指令序列号为1，用于DG-LAB协议的命令同步
-	}, nil
+		sequence:   1,                    // 初始化指令序列号为1，用于DG-LAB协议的命令同步
+		connState:  StateDisconnected,    // 初始为未连接，由Start启动的连接监管负责连接
+		lostCh:     make(chan string, 1), // 链路丢失通知通道
+		batteryCap: noStrengthCap,        // 初始不因电量限制强度
+
+		commandTimes: make(map[string][]time.Time),
+		policy:       engine,
+	}
+
+	// 所有写入都经过输出守卫，上层限制逻辑出错时也不会把违规的帧写入设备
+	c.publishGuardState()
+	c.guard = transport.NewGuard(tr, c.guardState, c.guardAlarm)
+	c.transport = c.guard
+
+	// 启动波形播放循环，按配置的间隔持续向设备推送波形帧
+	c.startPlayback()
+
+	// 处理设备返回的通知消息
+	go c.handleNotifications()
+
+	// 处理电量上报
+	go c.handleBatteryUpdates()
+
+	// 监视控制租约，客户端失联时输出归零
+	go c.watchLease()
+
+	// 输出会话计时，超过时长限制时归零并冷却
+	go c.watchSession()
+
+	return c, nil
+}
+
+// newTransport 根据配置创建传输层
+func newTransport(cfg *config.Config) (transport.Transport, error) {
+	switch cfg.Transport.Type {
+	case "", transport.TypeBluetooth:
+		return bluetooth.NewBluetoothAdapter(cfg.Bluetooth)
+	case transport.TypeSimulator:
+		return transport.NewSimulator(), nil
+	default:
+		return nil, fmt.Errorf("未知的传输层类型: %s", cfg.Transport.Type)
+	}
 }
 
 // ScanAndConnect 扫描并连接到郊狼设备
 func (c *Controller) ScanAndConnect(timeout time.Duration) error {
-	//调用bluetooth.BluetoothAdapter的ScanAndConnect
-	return c.btAdapter.ScanAndConnect(timeout, c.config.Bluetooth.DeviceNames)
+	//调用传输层的ScanAndConnect
+	return c.transport.ScanAndConnect(timeout, c.config.Bluetooth.DeviceNames)
 }
 
-// SetStrength 设置通道强度
-func (c *Controller) SetStrength(channel string, strength int) error {
-	if !c.btAdapter.IsConnected() {
-		return fmt.Errorf("设备未连接")
+// SetStrength 设置通道强度，caller为发出指令的客户端
+// 返回实际执行的结果，受策略规则和速率限制调整时在结果中说明
+func (c *Controller) SetStrength(caller Caller, channel string, strength int) (StrengthResult, error) {
+	if err := c.checkStrengthCommand(); err != nil {
+		return StrengthResult{Channel: channel, Requested: strength}, err
 	}
 
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	// 验证强度值
-	strength = int(protocol.ValidateStrength(strength))
-
-	// 检查上限
-	var limit int
-	switch channel {
-	case "A", "a":
-		limit = c.channelState.ALimit
-		if strength > limit {
-			strength = limit
-			log.Printf("强度超过上限，调整为: %d", strength)
-		}
-		c.channelState.AStrength = strength
-	case "B", "b":
-		limit = c.channelState.BLimit
-		if strength > limit {
-			strength = limit
-			log.Printf("强度超过上限，调整为: %d", strength)
-		}
-		c.channelState.BStrength = strength
-	default:
-		return fmt.Errorf("无效的通道: %s", channel)
+	channel, err := normalizeChannel(channel)
+	if err != nil {
+		return StrengthResult{Requested: strength}, err
 	}
 
-	// 构建并发送B0指令
-	cmd := c.buildB0Command()
-	switch channel {
-	case "A", "a":
-		cmd.AMode = protocol.StrengthModeAbsolute
-		cmd.AStrength = byte(strength)
-	case "B", "b":
-		cmd.BMode = protocol.StrengthModeAbsolute
-		cmd.BStrength = byte(strength)
+	result, err := c.applyStrength(policy.ActionSetStrength, caller, channel, strength)
+	if err != nil {
+		return result, err
 	}
 
-	log.Printf("设置%s通道强度为: %d", channel, strength)
-	return c.sendCommand(cmd)
+	log.Printf("设置%s通道强度为: %d", channel, result.Applied)
+	return result, nil
 }
 
-// sendCommand 发送命令到设备
-func (c *Controller) sendCommand(cmd *protocol.B0Command) error {
+// checkStrengthCommand 检查设备是否可以接受强度指令
+func (c *Controller) checkStrengthCommand() error {
+	if !c.transport.IsConnected() {
+		return fmt.Errorf("设备未连接")
+	}
+	return c.checkArmed()
+}
+
+// sendCommand 发送命令到设备，写入串行化，B0/BF指令不会交错
+func (c *Controller) sendCommand(cmd protocol.Command) error {
 	data := cmd.ToBytes()
 	/*
 		protocol.B0Command
@@ -133,7 +226,9 @@ func (c *Controller) sendCommand(cmd *protocol.B0Command) error {
 		AWaveData: [4]mygodblab/internal/protocol.WaveData
 		[4]protocol.WaveData [{Frequency: 10, Strength: 20},{Frequency: 10, Strength: 20},{Frequency: 10, Strength: 20},{Frequency: 10, Strength: 20}]
 	*/
-	err := c.btAdapter.WriteCharacteristic(data)
+	c.writeMu.Lock()
+	err := c.transport.WriteCharacteristic(data)
+	c.writeMu.Unlock()
 	if err != nil {
 		return fmt.Errorf("发送命令失败: %w", err)
 	}
@@ -146,122 +241,204 @@ func (c *Controller) PrintStatus() {
 	defer c.mu.RUnlock()
 
 	fmt.Println("\n=== 设备状态 ===")
-	fmt.Printf("连接状态: %v\n", c.btAdapter.IsConnected())
-	fmt.Printf("A通道强度: %d/%d\n", c.channelState.AStrength, c.channelState.ALimit)
-	fmt.Printf("B通道强度: %d/%d\n", c.channelState.BStrength, c.channelState.BLimit)
-	fmt.Printf("当前波形: %s\n", c.channelState.CurrentPulse)
+	fmt.Printf("连接状态: %s\n", c.connState)
+	if c.stopped.Load() {
+		fmt.Printf("*** 急停已触发: %s（输入 rearm 解除）***\n", c.stopReason)
+	}
+	if c.reconnects > 0 || c.lastConnErr != "" {
+		fmt.Printf("重连次数: %d  最近错误: %s\n", c.reconnects, c.lastConnErr)
+	}
+	fmt.Printf("A通道强度: %d/%d%s\n", c.channelState.AStrength, c.channelState.ALimit, disabledMark(c.channelState.AEnabled))
+	fmt.Printf("B通道强度: %d/%d%s\n", c.channelState.BStrength, c.channelState.BLimit, disabledMark(c.channelState.BEnabled))
+	fmt.Printf("平衡参数: A(频率%d 强度%d) B(频率%d 强度%d)\n",
+		c.channelState.AFrequencyBalance, c.channelState.AIntensityBalance,
+		c.channelState.BFrequencyBalance, c.channelState.BIntensityBalance)
+	fmt.Printf("当前波形: A=%s B=%s\n", c.channelState.APulse, c.channelState.BPulse)
+	for _, channel := range []string{"A", "B"} {
+		for _, f := range *c.fireSlot(channel) {
+			fmt.Printf("%s通道叠加#%d: 强度%+d 波形%s 剩余%.1f秒（输出%d）\n", channel, f.id, f.delta,
+				firePulseName(f.pulse), clampRemaining(time.Until(f.expires)).Seconds(), c.outputStrength(channel))
+		}
+	}
 	if c.channelState.BatteryLevel > 0 {
 		fmt.Printf("电量: %d%%\n", c.channelState.BatteryLevel)
 	}
+	if c.batteryCap != noStrengthCap {
+		fmt.Printf("低电量强度限制: %d\n", c.batteryCap)
+	}
+	if c.lease != nil {
+		fmt.Printf("控制租约: %s 持有，剩余%v\n", c.lease.Holder, c.lease.Remaining().Round(time.Second))
+	}
 	fmt.Println()
 }
 
 // Close 关闭控制器
 func (c *Controller) Close() error {
-	if c.btAdapter != nil {
-		return c.btAdapter.Disconnect()
+	c.stopPlayback()
+
+	if c.transport != nil {
+		return c.transport.Disconnect()
 	}
 	return nil
 }
 
-// SetLimit 设置通道强度上限
+// SetLimit 设置通道强度上限，上限不能超过策略中的绝对上限
 func (c *Controller) SetLimit(channel string, limit int) error {
 	c.mu.Lock()
-	defer c.mu.Unlock()
 
-	limit = int(protocol.ValidateStrength(limit))
+	channel, err := normalizeChannel(channel)
+	if err != nil {
+		c.mu.Unlock()
+		return err
+	}
+
+	decision := c.evaluate(policy.ActionSetLimit, Caller{}, channel, limit, "")
+	limit = decision.Strength
 
 	switch channel {
-	case "A", "a":
+	case "A":
 		c.channelState.ALimit = limit
-		// 如果当前强度超过新上限，调整当前强度
-		if c.channelState.AStrength > limit {
-			c.channelState.AStrength = limit
-			log.Printf("A通道当前强度超过新上限，调整为: %d", limit)
-		}
-	case "B", "b":
+	case "B":
 		c.channelState.BLimit = limit
-		if c.channelState.BStrength > limit {
-			c.channelState.BStrength = limit
-			log.Printf("B通道当前强度超过新上限，调整为: %d", limit)
-		}
-	default:
-		return fmt.Errorf("无效的通道: %s", channel)
 	}
+	c.publishGuardState()
+	c.stateChanged()
+	// 如果当前强度超过新上限，调整当前强度
+	if c.currentStrength(channel) > limit {
+		c.setCurrentStrength(channel, limit)
+		c.markPending(channel)
+		log.Printf("%s通道当前强度超过新上限，调整为: %d", channel, limit)
+	}
+	c.mu.Unlock()
 
 	log.Printf("%s通道强度上限设置为: %d", channel, limit)
-	return nil
+
+	// 同时写入设备软上限，即使本程序崩溃设备也不会超过上限
+	return c.syncSoftLimits()
 }
 
-// SetPulse 设置波形
-func (c *Controller) SetPulse(pulseID string) error {
+// SetPulse 设置通道波形，channel为空或"AB"时同时设置两个通道
+// 新波形有最大强度规则时，当前强度按策略调低
+func (c *Controller) SetPulse(channel string, pulseID string) error {
 	pulseData, err := c.pulseManager.GetPulse(pulseID)
 	if err != nil {
 		return fmt.Errorf("获取波形失败: %w", err)
 	}
 
 	c.mu.Lock()
-	c.channelState.CurrentPulse = pulseID
-	c.mu.Unlock()
+	defer c.mu.Unlock()
+
+	var channels []string
+	switch channel {
+	case "", "AB", "ab":
+		channels = []string{"A", "B"}
+		channel = "AB"
+	default:
+		normalized, err := normalizeChannel(channel)
+		if err != nil {
+			return err
+		}
+		channels = []string{normalized}
+		channel = normalized
+	}
 
-	log.Printf("切换到波形: %s (%s)", pulseData.Name, pulseID)
+	for _, ch := range channels {
+		// 同时设置两个通道时，禁用的通道只记录波形
+		if channel == "AB" && !c.channelEnabled(ch) {
+			c.setPulse(ch, pulseID)
+			continue
+		}
+
+		if err := c.reviewStrength(policy.ActionSetPulse, ch, pulseID); err != nil {
+			return err
+		}
+		c.setPulse(ch, pulseID)
+	}
+
+	log.Printf("%s通道切换到波形: %s (%s)", channel, pulseData.Name, pulseID)
 	return nil
 }
 
+// setPulse 切换通道波形，从第一帧开始播放，调用方需持有写锁
+func (c *Controller) setPulse(channel, pulseID string) {
+	switch channel {
+	case "A":
+		c.channelState.APulse = pulseID
+		c.frameIndexA = 0
+	case "B":
+		c.channelState.BPulse = pulseID
+		c.frameIndexB = 0
+	}
+	c.stateChanged()
+}
+
 // buildB0Command 构建基础B0指令 - 用于创建发送给设备的B0控制指令
-// B0 指令写入通道强度变化和通道波形数据,
+// B0 指令写入通道强度变化和通道波形数据，每次调用推进一帧波形，到末尾后循环
+// 调用方需持有写锁
 func (c *Controller) buildB0Command() *protocol.B0Command {
-	// 从脉冲管理器获取当前选择的波形数据
-	pulseData, _ := c.pulseManager.GetPulse(c.channelState.CurrentPulse)
-
-	// 创建新的B0指令对象，设置序列号和初始模式
+	// 创建新的B0指令对象，设置初始模式；只改变波形的指令序列号为0
 	cmd := &protocol.B0Command{
-		Sequence: c.sequence,                    // 设置指令序列号
+		Sequence: 0,                             // 强度变更由attachStrengthChange分配序列号
 		AMode:    protocol.StrengthModeNoChange, // A通道强度模式设为不变
 		BMode:    protocol.StrengthModeNoChange, // B通道强度模式设为不变
 	}
 
-	// 设置波形数据 - 检查是否有可用的波形数据
-	if pulseData != nil && len(pulseData.PulseData) > 0 {
-		// 使用第一组波形数据 - 获取十六进制格式的波形数据
-		hexData := pulseData.PulseData[0]
-		// 将十六进制数据转换为A通道的波形数据
-		if aWaves, err := protocol.WaveDataFromHex(hexData); err == nil {
-			cmd.AWaveData = aWaves
-		}
-		// 将十六进制数据转换为B通道的波形数据
-		if bWaves, err := protocol.WaveDataFromHex(hexData); err == nil {
-			cmd.BWaveData = bWaves
-		}
+	// 两个通道各自播放自己的波形和游标（叠加期间播放叠加波形），禁用的通道发送无效波形使设备不输出
+	if c.channelState.AEnabled {
+		cmd.AWaveData = c.nextWaveFrame(c.outputPulse("A"), &c.frameIndexA)
 	} else {
-		// 如果没有可用波形，使用默认波形数据：频率10Hz，强度50%
-		defaultWave := protocol.WaveData{Frequency: 10, Strength: 50}
-		// 为A和B通道的4个波形槽都设置默认波形
-		for i := 0; i < 4; i++ {
-			cmd.AWaveData[i] = defaultWave
-			cmd.BWaveData[i] = defaultWave
-		}
+		cmd.AWaveData = protocol.InactiveWaveData()
 	}
-
-	// 递增序列号
-	c.sequence++
-	// 序列号超过15则重置为1（序列号范围：1-15）
-	if c.sequence > 15 {
-		c.sequence = 1
+	if c.channelState.BEnabled {
+		cmd.BWaveData = c.nextWaveFrame(c.outputPulse("B"), &c.frameIndexB)
+	} else {
+		cmd.BWaveData = protocol.InactiveWaveData()
 	}
 
 	// 返回构建好的B0指令
 	return cmd
 }
 
+// nextWaveFrame 取出波形的当前帧并推进播放游标，到末尾后循环
+func (c *Controller) nextWaveFrame(pulseID string, frameIndex *int) [4]protocol.WaveData {
+	// 从脉冲管理器获取当前选择的波形数据
+	pulseData, _ := c.pulseManager.GetPulse(pulseID)
+
+	// 设置波形数据 - 检查是否有可用的波形数据
+	if pulseData != nil && len(pulseData.PulseData) > 0 {
+		if *frameIndex >= len(pulseData.PulseData) {
+			*frameIndex = 0
+		}
+		// 获取十六进制格式的波形数据
+		hexData := pulseData.PulseData[*frameIndex]
+		*frameIndex = (*frameIndex + 1) % len(pulseData.PulseData)
+		// 将十六进制数据转换为波形数据
+		if waves, err := protocol.WaveDataFromHex(hexData); err == nil {
+			return waves
+		}
+	}
+
+	// 如果没有可用波形，使用默认波形数据：频率10Hz，强度50%
+	defaultWave := protocol.WaveData{Frequency: 10, Strength: 50}
+	return [4]protocol.WaveData{defaultWave, defaultWave, defaultWave, defaultWave}
+}
+
 // ListPulses 列出可用波形
 func (c *Controller) ListPulses() {
 	pulses := c.pulseManager.ListPulses()
 	fmt.Println("\n=== 可用波形 ===")
+	c.mu.RLock()
+	aPulse, bPulse := c.channelState.APulse, c.channelState.BPulse
+	c.mu.RUnlock()
 	for _, pulse := range pulses {
-		marker := "  "
-		if pulse.ID == c.channelState.CurrentPulse {
-			marker = "* "
+		marker := "   "
+		switch {
+		case pulse.ID == aPulse && pulse.ID == bPulse:
+			marker = "AB "
+		case pulse.ID == aPulse:
+			marker = "A  "
+		case pulse.ID == bPulse:
+			marker = "B  "
 		}
 		fmt.Printf("%s%s - %s\n", marker, pulse.ID, pulse.Name)
 	}
@@ -270,120 +447,50 @@ func (c *Controller) ListPulses() {
 
 // AddStrength 增加通道强度
 // TODO:NOTICE 增加强度 （通过蓝牙发送给设备指令）
-func (c *Controller) AddStrength(channel string, value int) error {
-	//channel是通道字符串 A还是B value是数值
-	if !c.btAdapter.IsConnected() {
-		return fmt.Errorf("设备未连接")
+func (c *Controller) AddStrength(caller Caller, channel string, value int) (StrengthResult, error) {
+	if err := c.checkStrengthCommand(); err != nil {
+		return StrengthResult{Channel: channel}, err
 	}
 
 	c.mu.Lock() // 加锁，确保线程安全
 	defer c.mu.Unlock()
 
-	// 获取当前强度
-	var currentStrength int
-	switch channel {
-	case "A", "a":
-		currentStrength = c.channelState.AStrength
-	case "B", "b":
-		currentStrength = c.channelState.BStrength
-	default:
-		return fmt.Errorf("无效的通道: %s", channel)
-	}
-
-	// 计算新强度
-	newStrength := currentStrength + value
-	if newStrength < 0 {
-		newStrength = 0
-	}
-
-	// 验证强度值
-	newStrength = int(protocol.ValidateStrength(newStrength)) // 验证强度值是否在有效范围内
-	//这个有效范围在0到200之间
-
-	// 检查上限
-	var limit int
-	switch channel {
-	case "A", "a":
-		limit = c.channelState.ALimit
-		if newStrength > limit {
-			newStrength = 20
-			log.Printf("强度超过上限，调整为: %d", newStrength)
-		}
-		c.channelState.AStrength = newStrength
-	case "B", "b":
-		limit = c.channelState.BLimit
-		if newStrength > limit {
-			newStrength = 20
-			log.Printf("强度超过上限，调整为: %d", newStrength)
-		}
-		c.channelState.BStrength = newStrength
+	channel, err := normalizeChannel(channel)
+	if err != nil {
+		return StrengthResult{}, err
 	}
 
-	// 构建并发送B0指令
-	cmd := c.buildB0Command()
-	switch channel {
-	case "A", "a":
-		cmd.AMode = protocol.StrengthModeAbsolute
-		cmd.AStrength = byte(newStrength)
-	case "B", "b":
-		cmd.BMode = protocol.StrengthModeAbsolute
-		cmd.BStrength = byte(newStrength)
+	// 超过上限时由策略调整到允许的最大值
+	result, err := c.applyStrength(policy.ActionAddStrength, caller, channel, c.currentStrength(channel)+value)
+	if err != nil {
+		return result, err
 	}
 
-	log.Printf("增加%s通道强度%d，当前强度: %d", channel, value, newStrength)
-	return c.sendCommand(cmd) //TODO:NOTICE 发送指令
+	log.Printf("增加%s通道强度%d，当前强度: %d", channel, value, result.Applied)
+	return result, nil
 }
 
 // SubStrength 减少通道强度
-func (c *Controller) SubStrength(channel string, value int) error {
-	if !c.btAdapter.IsConnected() {
-		return fmt.Errorf("设备未连接")
+func (c *Controller) SubStrength(caller Caller, channel string, value int) (StrengthResult, error) {
+	if err := c.checkStrengthCommand(); err != nil {
+		return StrengthResult{Channel: channel}, err
 	}
 
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	// 获取当前强度
-	var currentStrength int
-	switch channel {
-	case "A", "a":
-		currentStrength = c.channelState.AStrength
-	case "B", "b":
-		currentStrength = c.channelState.BStrength
-	default:
-		return fmt.Errorf("无效的通道: %s", channel)
-	}
-
-	// 计算新强度
-	newStrength := currentStrength - value
-	if newStrength < 0 {
-		newStrength = 0
-	}
-
-	// 验证强度值
-	newStrength = int(protocol.ValidateStrength(newStrength))
-
-	// 更新状态
-	switch channel {
-	case "A", "a":
-		c.channelState.AStrength = newStrength
-	case "B", "b":
-		c.channelState.BStrength = newStrength
+	channel, err := normalizeChannel(channel)
+	if err != nil {
+		return StrengthResult{}, err
 	}
 
-	// 构建并发送B0指令
-	cmd := c.buildB0Command()
-	switch channel {
-	case "A", "a":
-		cmd.AMode = protocol.StrengthModeAbsolute
-		cmd.AStrength = byte(newStrength)
-	case "B", "b":
-		cmd.BMode = protocol.StrengthModeAbsolute
-		cmd.BStrength = byte(newStrength)
+	result, err := c.applyStrength(policy.ActionSubStrength, caller, channel, c.currentStrength(channel)-value)
+	if err != nil {
+		return result, err
 	}
 
-	log.Printf("减少%s通道强度%d，当前强度: %d", channel, value, newStrength)
-	return c.sendCommand(cmd)
+	log.Printf("减少%s通道强度%d，当前强度: %d", channel, value, result.Applied)
+	return result, nil
 }
 
 // GetStatus 获取设备当前状态
@@ -392,14 +499,8 @@ func (c *Controller) GetStatus() *ChannelState {
 	defer c.mu.RUnlock()
 
 	// 返回通道状态的副本，避免外部直接修改
-	return &ChannelState{
-		AStrength:    c.channelState.AStrength,
-		BStrength:    c.channelState.BStrength,
-		ALimit:       c.channelState.ALimit,
-		BLimit:       c.channelState.BLimit,
-		CurrentPulse: c.channelState.CurrentPulse,
-		BatteryLevel: c.channelState.BatteryLevel,
-	}
+	state := *c.channelState
+	return &state
 }
 
 // GetPulseList 获取可用波形列表
@@ -407,7 +508,12 @@ func (c *Controller) GetPulseList() []*pulse.PulseData {
 	return c.pulseManager.ListPulses()
 }
 
+// GetPulse 获取指定ID的波形
+func (c *Controller) GetPulse(id string) (*pulse.PulseData, error) {
+	return c.pulseManager.GetPulse(id)
+}
+
 // IsConnected 获取设备连接状态
 func (c *Controller) IsConnected() bool {
-	return c.btAdapter.IsConnected()
+	return c.transport.IsConnected()
 }
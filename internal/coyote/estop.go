@@ -0,0 +1,128 @@
+package coyote
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"mygodblab/internal/protocol"
+)
+
+// StopStatus 急停状态
+type StopStatus struct {
+	Stopped bool      // 是否处于急停锁定状态
+	Reason  string    // 急停原因
+	Time    time.Time // 急停时间
+}
+
+// EmergencyStop 急停：立即将两个通道强度归零并锁定，直到调用Rearm解除
+//
+// 急停先设置原子锁存标志，再直接写入绝对值0的B0帧和软上限为0的BF帧，
+// 不等待控制器状态锁，也不经过播放循环，只与单次写入串行。
+// 锁存期间播放循环停止发送波形，所有提升强度的操作都会被拒绝。
+func (c *Controller) EmergencyStop(reason string) error {
+	if reason == "" {
+		reason = "未说明原因"
+	}
+	first := c.stopped.CompareAndSwap(false, true)
+
+	// 无论是否已锁存都重新写入停止指令，保证设备处于停止状态
+	err := c.writeStopFrames()
+
+	if first {
+		// 设备已停止，再清理控制器状态（可能需要等待其他操作释放锁）
+		c.mu.Lock()
+		c.stopReason = reason
+		c.stoppedAt = time.Now()
+		c.channelState.AStrength = 0
+		c.channelState.BStrength = 0
+		c.rampA, c.rampB = nil, nil
+		c.firesA, c.firesB = nil, nil
+		c.pendingA, c.pendingB = false, false
+		c.inflight = nil
+		c.mu.Unlock()
+
+		c.emitEvent(EventEmergencyStop, "急停已触发: %s", reason)
+	}
+
+	if err != nil {
+		return fmt.Errorf("急停已锁存，但写入设备失败: %w", err)
+	}
+	return nil
+}
+
+// Rearm 解除急停锁定，强度保持为0，恢复配置的软上限并继续播放波形
+func (c *Controller) Rearm() error {
+	if !c.stopped.Load() {
+		return fmt.Errorf("当前未处于急停状态")
+	}
+
+	c.mu.Lock()
+	c.stopReason = ""
+	c.stoppedAt = time.Time{}
+	c.frameIndexA, c.frameIndexB = 0, 0
+	c.pendingA, c.pendingB = true, true // 以绝对值0重新同步设备强度
+	c.stopped.Store(false)
+	c.mu.Unlock()
+
+	c.emitEvent(EventRearmed, "急停已解除")
+	return c.syncSoftLimits()
+}
+
+// StopStatus 获取急停状态
+func (c *Controller) StopStatus() StopStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return StopStatus{
+		Stopped: c.stopped.Load(),
+		Reason:  c.stopReason,
+		Time:    c.stoppedAt,
+	}
+}
+
+// IsStopped 是否处于急停锁定状态（不加锁）
+func (c *Controller) IsStopped() bool {
+	return c.stopped.Load()
+}
+
+// checkArmed 急停锁定期间拒绝改变输出
+func (c *Controller) checkArmed() error {
+	if c.stopped.Load() {
+		return fmt.Errorf("急停已触发，需先解除急停(rearm)")
+	}
+	return nil
+}
+
+// writeStopFrames 直接向设备写入停止指令：两个通道绝对值0 + 软上限0
+func (c *Controller) writeStopFrames() error {
+	if !c.transport.IsConnected() {
+		log.Println("急停: 设备未连接，重连后将以软上限0同步")
+		return nil
+	}
+
+	b0 := &protocol.B0Command{
+		Sequence:  0,
+		AMode:     protocol.StrengthModeAbsolute,
+		BMode:     protocol.StrengthModeAbsolute,
+		AStrength: 0,
+		BStrength: 0,
+		AWaveData: protocol.InactiveWaveData(),
+		BWaveData: protocol.InactiveWaveData(),
+	}
+	// 平衡参数不影响输出，使用配置值，避免读取状态时等待锁
+	bf := &protocol.BFCommand{
+		ALimit:            0,
+		BLimit:            0,
+		AFrequencyBalance: validateBalance(c.config.Channels.AChannel.FrequencyBalance),
+		BFrequencyBalance: validateBalance(c.config.Channels.BChannel.FrequencyBalance),
+		AIntensityBalance: validateBalance(c.config.Channels.AChannel.IntensityBalance),
+		BIntensityBalance: validateBalance(c.config.Channels.BChannel.IntensityBalance),
+	}
+
+	log.Println("急停: 写入强度归零和软上限0")
+	if err := c.sendCommand(b0); err != nil {
+		return err
+	}
+	return c.sendCommand(bf)
+}
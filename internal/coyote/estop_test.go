@@ -0,0 +1,81 @@
+package coyote
+
+import (
+	"testing"
+
+	"mygodblab/internal/protocol"
+)
+
+func TestEmergencyStopLatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		actions    []string // stop/tick/rearm
+		wantWrites int
+		wantStop   bool
+	}{
+		{"锁存后播放循环不发帧", []string{"stop", "tick", "tick"}, 2, true},
+		{"重复急停重新写入停止指令", []string{"stop", "stop", "tick"}, 4, true},
+		{"解除后恢复软上限并以0同步强度", []string{"stop", "rearm", "tick"}, 4, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := &frameRecorder{}
+			c := tickController(tr)
+			for _, action := range tt.actions {
+				switch action {
+				case "stop":
+					if err := c.EmergencyStop("测试"); err != nil {
+						t.Fatalf("EmergencyStop() error = %v", err)
+					}
+				case "tick":
+					c.tick()
+				case "rearm":
+					if err := c.Rearm(); err != nil {
+						t.Fatalf("Rearm() error = %v", err)
+					}
+				}
+			}
+
+			if len(tr.writes) != tt.wantWrites {
+				t.Fatalf("写入%d帧, want %d", len(tr.writes), tt.wantWrites)
+			}
+			if c.IsStopped() != tt.wantStop {
+				t.Errorf("IsStopped() = %v, want %v", c.IsStopped(), tt.wantStop)
+			}
+			if c.channelState.AStrength != 0 {
+				t.Errorf("A通道强度 = %d, want 0", c.channelState.AStrength)
+			}
+
+			// 最后一帧必须让设备强度为0
+			last := tr.writes[len(tr.writes)-1]
+			switch last[0] {
+			case 0xB0:
+				cmd, err := protocol.ParseB0Command(last)
+				if err != nil {
+					t.Fatalf("ParseB0Command() error = %v", err)
+				}
+				if cmd.AMode != protocol.StrengthModeAbsolute || cmd.AStrength != 0 {
+					t.Errorf("最后一帧A通道 mode = %d strength = %d, want 绝对设置0", cmd.AMode, cmd.AStrength)
+				}
+			case 0xBF:
+				cmd, err := protocol.ParseBFCommand(last)
+				if err != nil {
+					t.Fatalf("ParseBFCommand() error = %v", err)
+				}
+				if cmd.ALimit != 0 || cmd.BLimit != 0 {
+					t.Errorf("急停后软上限 = %d/%d, want 0/0", cmd.ALimit, cmd.BLimit)
+				}
+			}
+		})
+	}
+}
+
+func TestEmergencyStopRejectsStrengthCommands(t *testing.T) {
+	c := tickController(&frameRecorder{})
+	if err := c.EmergencyStop("测试"); err != nil {
+		t.Fatalf("EmergencyStop() error = %v", err)
+	}
+	if err := c.checkStrengthCommand(); err == nil {
+		t.Error("急停锁存期间允许了强度指令")
+	}
+}
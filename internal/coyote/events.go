@@ -0,0 +1,94 @@
+package coyote
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// EventType 控制器事件类型
+type EventType string
+
+const (
+	EventBatteryLow       EventType = "battery_low"       // 电量低于低电量阈值
+	EventBatteryCritical  EventType = "battery_critical"  // 电量即将耗尽
+	EventBatteryRecovered EventType = "battery_recovered" // 电量恢复正常
+	EventEmergencyStop    EventType = "emergency_stop"    // 急停已触发
+	EventRearmed          EventType = "rearmed"           // 急停已解除
+	EventLeaseOpened      EventType = "lease_opened"      // 客户端打开控制租约
+	EventLeaseReleased    EventType = "lease_released"    // 客户端释放控制租约
+	EventLeaseExpired     EventType = "lease_expired"     // 控制租约过期，输出归零
+	EventSessionLimit     EventType = "session_limit"     // 输出时长达到上限，归零并进入冷却
+	EventAutoOff          EventType = "auto_off"          // 通道自动关闭时间已到
+	EventOutputGuard      EventType = "output_guard"      // 输出守卫拒绝了违规的帧
+	EventStateChanged     EventType = "state_changed"     // 通道、连接或电量状态变化，不记录日志
+)
+
+// Event 控制器事件
+type Event struct {
+	Type    EventType // 事件类型
+	Message string    // 事件描述
+	Time    time.Time // 发生时间
+}
+
+// eventBus 事件分发器，使用独立的锁，可以在持有控制器锁时发布事件
+type eventBus struct {
+	mu          sync.Mutex
+	subscribers map[int]chan Event
+	nextID      int
+}
+
+// Subscribe 订阅控制器事件，返回事件通道和取消订阅函数
+// 订阅者处理过慢时事件会被丢弃，不会阻塞控制器
+func (c *Controller) Subscribe() (<-chan Event, func()) {
+	c.events.mu.Lock()
+	defer c.events.mu.Unlock()
+
+	if c.events.subscribers == nil {
+		c.events.subscribers = make(map[int]chan Event)
+	}
+	id := c.events.nextID
+	c.events.nextID++
+	ch := make(chan Event, 16)
+	c.events.subscribers[id] = ch
+
+	cancel := func() {
+		c.events.mu.Lock()
+		defer c.events.mu.Unlock()
+		if sub, ok := c.events.subscribers[id]; ok {
+			delete(c.events.subscribers, id)
+			close(sub)
+		}
+	}
+	return ch, cancel
+}
+
+// emitEvent 记录并向所有订阅者发布事件
+func (c *Controller) emitEvent(eventType EventType, format string, args ...interface{}) {
+	event := Event{
+		Type:    eventType,
+		Message: fmt.Sprintf(format, args...),
+		Time:    time.Now(),
+	}
+	log.Printf("[事件] %s: %s", event.Type, event.Message)
+	c.publish(event)
+}
+
+// stateChanged 通知订阅者通道、连接或电量状态已变化，订阅者需要时自行读取状态
+// 渐变时每一帧都会变化，只发布不记录日志
+func (c *Controller) stateChanged() {
+	c.publish(Event{Type: EventStateChanged, Time: time.Now()})
+}
+
+// publish 向所有订阅者发布事件，订阅者的通道已满时丢弃
+func (c *Controller) publish(event Event) {
+	c.events.mu.Lock()
+	defer c.events.mu.Unlock()
+	for _, ch := range c.events.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
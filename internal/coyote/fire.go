@@ -0,0 +1,298 @@
+package coyote
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"mygodblab/internal/policy"
+)
+
+// maxFireDuration 单次叠加的最长持续时间
+const maxFireDuration = time.Minute
+
+// fire 一次临时叠加：在基础强度上增加delta，并可临时替换波形
+type fire struct {
+	id      int
+	delta   int       // 叠加的强度增量（已经过策略和速率限制），可以为负
+	pulse   string    // 叠加期间播放的波形，为空表示沿用基础波形
+	expires time.Time // 到期时间
+}
+
+// FireResult 叠加的实际执行结果
+// Requested/Applied 为叠加后的输出强度，Duration 为叠加持续时间
+type FireResult struct {
+	StrengthResult
+	ID    int    // 叠加编号，增量被限制为0且不换波形时为0
+	Pulse string // 叠加波形，为空表示沿用基础波形
+}
+
+// String 描述实际执行的结果
+func (r FireResult) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s通道叠加%.1f秒，输出强度%d，波形%s", r.Channel, r.Duration.Seconds(), r.Applied, firePulseName(r.Pulse))
+	if r.Adjusted() {
+		fmt.Fprintf(&sb, "（请求%d，%s）", r.Requested, strings.Join(r.Notes, "；"))
+	}
+	return sb.String()
+}
+
+// FireStatus 正在生效的叠加
+type FireStatus struct {
+	ID        int           // 叠加编号
+	Channel   string        // 通道
+	Delta     int           // 强度增量
+	Pulse     string        // 叠加波形，为空表示沿用基础波形
+	Remaining time.Duration // 剩余时间
+}
+
+// Fire 在通道上叠加一次临时输出：duration内强度增加delta，pulseID非空时临时播放该波形，到期后自动移除
+//
+// 合并规则：叠加不修改基础状态。叠加期间的设置强度、渐变、更换波形照常作用于基础状态；
+// 输出强度 = 基础强度 + 所有生效叠加的增量（限制在0到通道上限之间），
+// 输出波形取最近开始且指定了波形的叠加。多个叠加可以重叠，各自到期后单独移除，
+// 全部结束后输出恢复为届时的基础状态。叠加后的强度同样经过策略和速率限制。
+func (c *Controller) Fire(caller Caller, channel string, delta int, pulseID string, duration time.Duration) (FireResult, error) {
+	result := FireResult{StrengthResult: StrengthResult{Channel: channel, Duration: duration}, Pulse: pulseID}
+	if err := c.checkStrengthCommand(); err != nil {
+		return result, err
+	}
+	if duration <= 0 || duration > maxFireDuration {
+		return result, fmt.Errorf("叠加持续时间必须在0到%v之间: %v", maxFireDuration, duration)
+	}
+	if delta < -200 || delta > 200 {
+		return result, fmt.Errorf("强度增量必须在-200到200之间: %d", delta)
+	}
+	if pulseID != "" {
+		if _, err := c.pulseManager.GetPulse(pulseID); err != nil {
+			return result, err
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	channel, err := normalizeChannel(channel)
+	if err != nil {
+		return result, err
+	}
+	result.Channel = channel
+
+	current := c.outputStrength(channel)
+	target := current + delta
+	result.Requested = target
+
+	firePulse := pulseID
+	if firePulse == "" {
+		firePulse = c.outputPulse(channel)
+	}
+	decision := c.evaluateFrom(policy.ActionFire, caller, channel, current, target, firePulse)
+	if !decision.Allowed {
+		return result, denialError(decision)
+	}
+	if decision.Rule != "" {
+		result.note("规则%s: %s，调整为%d", decision.Rule, decision.Reason, decision.Strength)
+	}
+
+	if err := c.checkCommandRate(caller.Client, channel, current, decision.Strength); err != nil {
+		return result, err
+	}
+	strength, err := c.limitIncrease(channel, current, decision.Strength, &result.StrengthResult)
+	if err != nil {
+		return result, err
+	}
+	result.Applied = strength
+	if strength == current && pulseID == "" {
+		return result, nil
+	}
+
+	c.nextFireID++
+	f := &fire{
+		id:      c.nextFireID,
+		delta:   strength - current,
+		pulse:   pulseID,
+		expires: time.Now().Add(duration),
+	}
+	slot := c.fireSlot(channel)
+	*slot = append(*slot, f)
+	result.ID = f.id
+	if pulseID != "" {
+		c.resetFrameIndex(channel)
+	}
+	c.markPending(channel)
+
+	log.Printf("%s通道叠加#%d: 强度%+d 波形%s，持续%v", channel, f.id, f.delta, firePulseName(pulseID), duration)
+	return result, nil
+}
+
+// CancelFire 立即移除通道上的所有叠加，channel为空时移除两个通道的叠加
+func (c *Controller) CancelFire(channel string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if channel == "" {
+		c.cancelFires("A")
+		c.cancelFires("B")
+		return nil
+	}
+	channel, err := normalizeChannel(channel)
+	if err != nil {
+		return err
+	}
+	c.cancelFires(channel)
+	return nil
+}
+
+// FireStatus 获取正在生效的叠加
+func (c *Controller) FireStatus() []FireStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := time.Now()
+	var list []FireStatus
+	for _, channel := range []string{"A", "B"} {
+		for _, f := range *c.fireSlot(channel) {
+			list = append(list, FireStatus{
+				ID:        f.id,
+				Channel:   channel,
+				Delta:     f.delta,
+				Pulse:     f.pulse,
+				Remaining: clampRemaining(f.expires.Sub(now)),
+			})
+		}
+	}
+	return list
+}
+
+// OutputStrength 获取通道实际输出的强度（基础强度加上临时叠加）
+func (c *Controller) OutputStrength(channel string) int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.outputStrength(channel)
+}
+
+// expireFires 移除到期的叠加，输出恢复为基础状态加上仍在生效的叠加，调用方需持有写锁
+func (c *Controller) expireFires(now time.Time) {
+	for _, channel := range []string{"A", "B"} {
+		c.removeFires(channel, func(f *fire) bool {
+			if now.Before(f.expires) {
+				return false
+			}
+			log.Printf("%s通道叠加#%d结束", channel, f.id)
+			return true
+		})
+	}
+}
+
+// cancelFires 移除通道上的所有叠加，调用方需持有写锁
+func (c *Controller) cancelFires(channel string) {
+	c.removeFires(channel, func(f *fire) bool {
+		log.Printf("%s通道叠加#%d已取消", channel, f.id)
+		return true
+	})
+}
+
+// removeFires 移除满足条件的叠加，输出强度或波形改变时重新同步，调用方需持有写锁
+func (c *Controller) removeFires(channel string, remove func(f *fire) bool) {
+	slot := c.fireSlot(channel)
+	if len(*slot) == 0 {
+		return
+	}
+
+	pulseBefore := c.outputPulse(channel)
+	kept := (*slot)[:0]
+	removed := false
+	for _, f := range *slot {
+		if remove(f) {
+			removed = true
+			continue
+		}
+		kept = append(kept, f)
+	}
+	if !removed {
+		return
+	}
+	*slot = kept
+
+	if c.outputPulse(channel) != pulseBefore {
+		c.resetFrameIndex(channel)
+	}
+	c.markPending(channel)
+}
+
+// trimFires 按策略复核叠加后的输出强度，超过允许值时从最近的叠加开始削减增量，调用方需持有写锁
+// 正增量削减完仍超出（如叠加波形有更低的最大强度）时，由最近的叠加以负增量抵消
+func (c *Controller) trimFires(channel string) {
+	fires := *c.fireSlot(channel)
+	if len(fires) == 0 {
+		return
+	}
+
+	output := c.outputStrength(channel)
+	decision := c.evaluateFrom(policy.ActionEnforce, Caller{}, channel, output, output, c.outputPulse(channel))
+	excess := output - decision.Strength
+	for i := len(fires) - 1; i >= 0 && excess > 0; i-- {
+		if fires[i].delta <= 0 {
+			continue
+		}
+		cut := min(fires[i].delta, excess)
+		fires[i].delta -= cut
+		excess -= cut
+	}
+	if excess > 0 {
+		fires[len(fires)-1].delta -= excess
+	}
+	if output != c.outputStrength(channel) {
+		c.markPending(channel)
+	}
+}
+
+// outputStrength 返回通道实际输出的强度：基础强度加上所有叠加的增量，调用方需持有锁
+func (c *Controller) outputStrength(channel string) int {
+	strength := c.currentStrength(channel)
+	fires := *c.fireSlot(channel)
+	if len(fires) == 0 {
+		return strength
+	}
+	for _, f := range fires {
+		strength += f.delta
+	}
+	return max(0, min(strength, c.currentLimit(channel)))
+}
+
+// outputPulse 返回通道实际播放的波形：最近开始且指定了波形的叠加，没有时为基础波形，调用方需持有锁
+func (c *Controller) outputPulse(channel string) string {
+	fires := *c.fireSlot(channel)
+	for i := len(fires) - 1; i >= 0; i-- {
+		if fires[i].pulse != "" {
+			return fires[i].pulse
+		}
+	}
+	return c.currentPulse(channel)
+}
+
+// fireSlot 返回通道的叠加列表，调用方需持有锁
+func (c *Controller) fireSlot(channel string) *[]*fire {
+	if channel == "B" || channel == "b" {
+		return &c.firesB
+	}
+	return &c.firesA
+}
+
+// resetFrameIndex 输出波形改变后从第一帧开始播放，调用方需持有写锁
+func (c *Controller) resetFrameIndex(channel string) {
+	if channel == "B" || channel == "b" {
+		c.frameIndexB = 0
+	} else {
+		c.frameIndexA = 0
+	}
+}
+
+// firePulseName 日志中显示的叠加波形
+func firePulseName(pulseID string) string {
+	if pulseID == "" {
+		return "不变"
+	}
+	return pulseID
+}
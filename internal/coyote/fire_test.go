@@ -0,0 +1,85 @@
+package coyote
+
+import (
+	"testing"
+	"time"
+
+	"mygodblab/internal/protocol"
+)
+
+func TestFire(t *testing.T) {
+	tests := []struct {
+		name      string
+		limit     int
+		delta     int
+		want      int  // 叠加期间的输出强度
+		wantFire  bool // 是否产生叠加
+		wantNotes bool // 结果是否说明了调整
+	}{
+		{name: "叠加在基础强度之上", limit: 100, delta: 30, want: 50, wantFire: true},
+		{name: "不超过通道上限", limit: 60, delta: 100, want: 60, wantFire: true, wantNotes: true},
+		{name: "负增量不低于0", limit: 100, delta: -30, want: 0, wantFire: true},
+		{name: "基础强度已在上限", limit: 20, delta: 10, want: 20, wantNotes: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tickController(&frameRecorder{})
+			c.pendingA = false
+			c.channelState.ALimit = tt.limit
+
+			result, err := c.Fire(Caller{Client: "mcp"}, "A", tt.delta, "", 3*time.Second)
+			if err != nil {
+				t.Fatalf("Fire() error = %v", err)
+			}
+			if result.Applied != tt.want || c.OutputStrength("A") != tt.want {
+				t.Errorf("Applied = %d, 输出强度 = %d, want %d", result.Applied, c.OutputStrength("A"), tt.want)
+			}
+			if got := len(c.firesA) > 0; got != tt.wantFire {
+				t.Fatalf("产生叠加 = %v, want %v", got, tt.wantFire)
+			}
+			if result.Adjusted() != tt.wantNotes {
+				t.Errorf("Notes = %v, want 说明调整 %v", result.Notes, tt.wantNotes)
+			}
+			if c.channelState.AStrength != 20 {
+				t.Errorf("叠加改变了基础强度: %d", c.channelState.AStrength)
+			}
+			if !tt.wantFire {
+				return
+			}
+
+			// 到期前保持叠加，到期后输出恢复为基础强度并重新同步设备
+			expires := c.firesA[0].expires
+			c.pendingA = false
+			c.expireFires(expires.Add(-time.Millisecond))
+			if len(c.firesA) != 1 || c.pendingA {
+				t.Fatalf("到期前叠加被移除")
+			}
+			c.expireFires(expires)
+			if len(c.firesA) != 0 || c.OutputStrength("A") != 20 || !c.pendingA {
+				t.Errorf("到期后 叠加%d个 输出强度%d pendingA=%v, want 0 20 true", len(c.firesA), c.OutputStrength("A"), c.pendingA)
+			}
+		})
+	}
+}
+
+func TestFireCappedWhenLimitLowered(t *testing.T) {
+	tr := &frameRecorder{}
+	c := tickController(tr)
+	if _, err := c.Fire(Caller{Client: "mcp"}, "A", 40, "", 3*time.Second); err != nil {
+		t.Fatalf("Fire() error = %v", err)
+	}
+
+	// 叠加期间上限降低，发出的帧不超过新的上限
+	c.channelState.ALimit = 30
+	c.tick()
+	if got := c.OutputStrength("A"); got != 30 {
+		t.Errorf("输出强度 = %d, want 30", got)
+	}
+	cmd, err := protocol.ParseB0Command(tr.writes[len(tr.writes)-1])
+	if err != nil {
+		t.Fatalf("ParseB0Command() error = %v", err)
+	}
+	if cmd.AMode != protocol.StrengthModeAbsolute || cmd.AStrength != 30 {
+		t.Errorf("发出的帧A通道 mode = %d strength = %d, want 绝对设置30", cmd.AMode, cmd.AStrength)
+	}
+}
@@ -0,0 +1,37 @@
+package coyote
+
+import (
+	"mygodblab/internal/transport"
+)
+
+// guardState 输出守卫读取的状态：急停标志直接读取原子变量，上限和启用状态读取快照
+// 不加状态锁，急停写入停止帧时不会被阻塞
+func (c *Controller) guardState() transport.GuardState {
+	state := transport.GuardState{}
+	if snapshot := c.guardLimits.Load(); snapshot != nil {
+		state = *snapshot
+	}
+	state.Stopped = c.stopped.Load()
+	return state
+}
+
+// publishGuardState 上限或通道启用状态改变后更新守卫快照，调用方需持有写锁
+func (c *Controller) publishGuardState() {
+	c.guardLimits.Store(&transport.GuardState{
+		ALimit:   c.channelState.ALimit,
+		BLimit:   c.channelState.BLimit,
+		AEnabled: c.channelState.AEnabled,
+		BEnabled: c.channelState.BEnabled,
+	})
+}
+
+// GuardRejected 输出守卫累计拒绝的帧数
+func (c *Controller) GuardRejected() int {
+	return c.guard.Rejected()
+}
+
+// guardAlarm 输出守卫拒绝写入时告警
+// 守卫拦下的帧说明上层限制逻辑有缺陷，通过事件通知订阅者
+func (c *Controller) guardAlarm(reason string) {
+	c.emitEvent(EventOutputGuard, "输出守卫拒绝写入: %s", reason)
+}
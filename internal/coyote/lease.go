@@ -0,0 +1,164 @@
+package coyote
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"time"
+)
+
+// leaseCheckInterval 检查控制租约是否过期的间隔
+const leaseCheckInterval = 500 * time.Millisecond
+
+// Lease 控制租约（死人开关）
+// 客户端打开租约后必须在TTL内续约，否则控制器认为客户端已失联，将所有通道渐变归零
+type Lease struct {
+	ID       string        // 租约ID，续约和释放时使用
+	Holder   string        // 持有者名称
+	TTL      time.Duration // 续约窗口
+	OpenedAt time.Time     // 打开时间
+	Expires  time.Time     // 过期时间
+}
+
+// Remaining 距离过期的剩余时间
+func (l Lease) Remaining() time.Duration {
+	remaining := time.Until(l.Expires)
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// OpenLease 打开控制租约，ttl为0时使用配置的默认值
+// 同一持有者重复打开会替换原租约；其他持有者的租约未过期时拒绝
+func (c *Controller) OpenLease(holder string, ttl time.Duration) (Lease, error) {
+	if holder == "" {
+		return Lease{}, fmt.Errorf("租约持有者不能为空")
+	}
+	ttl, err := c.leaseTTL(ttl)
+	if err != nil {
+		return Lease{}, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.lease != nil && c.lease.Holder != holder {
+		return Lease{}, fmt.Errorf("控制租约已由 %s 持有，剩余%v", c.lease.Holder, c.lease.Remaining().Round(time.Second))
+	}
+
+	id, err := newLeaseID()
+	if err != nil {
+		return Lease{}, err
+	}
+	now := time.Now()
+	c.lease = &Lease{
+		ID:       id,
+		Holder:   holder,
+		TTL:      ttl,
+		OpenedAt: now,
+		Expires:  now.Add(ttl),
+	}
+
+	c.emitEvent(EventLeaseOpened, "%s 打开了控制租约，续约窗口%v", holder, ttl)
+	return *c.lease, nil
+}
+
+// RenewLease 续约，过期时间从当前时刻重新计算
+func (c *Controller) RenewLease(id string) (Lease, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.lease == nil || c.lease.ID != id {
+		return Lease{}, fmt.Errorf("租约不存在或已过期: %s", id)
+	}
+	c.lease.Expires = time.Now().Add(c.lease.TTL)
+	return *c.lease, nil
+}
+
+// ReleaseLease 主动释放租约，输出保持不变
+func (c *Controller) ReleaseLease(id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.lease == nil || c.lease.ID != id {
+		return fmt.Errorf("租约不存在或已过期: %s", id)
+	}
+	holder := c.lease.Holder
+	c.lease = nil
+
+	c.emitEvent(EventLeaseReleased, "%s 释放了控制租约", holder)
+	return nil
+}
+
+// LeaseStatus 获取当前租约，没有租约时ok为false
+func (c *Controller) LeaseStatus() (lease Lease, ok bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.lease == nil {
+		return Lease{}, false
+	}
+	return *c.lease, true
+}
+
+// watchLease 定期检查租约是否过期，直到控制器关闭
+func (c *Controller) watchLease() {
+	ticker := time.NewTicker(leaseCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stopCh:
+			return
+		case now := <-ticker.C:
+			c.checkLeaseExpiry(now)
+		}
+	}
+}
+
+// checkLeaseExpiry 租约过期时将所有通道渐变归零并发布事件
+func (c *Controller) checkLeaseExpiry(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.lease == nil || now.Before(c.lease.Expires) {
+		return
+	}
+	holder := c.lease.Holder
+	c.lease = nil
+
+	rampDown := time.Duration(c.config.Lease.RampDown) * time.Second
+	c.rampAllToZero(rampDown)
+	c.emitEvent(EventLeaseExpired, "%s 的控制租约已过期，所有通道在%v内归零", holder, rampDown)
+}
+
+// rampAllToZero 将所有通道渐变到0，取代正在进行的渐变，调用方需持有写锁
+func (c *Controller) rampAllToZero(duration time.Duration) {
+	c.rampChannelToZero("A", duration)
+	c.rampChannelToZero("B", duration)
+	log.Printf("所有通道在%v内渐变归零", duration)
+}
+
+// leaseTTL 校验租约续约窗口，0表示使用配置的默认值
+func (c *Controller) leaseTTL(ttl time.Duration) (time.Duration, error) {
+	cfg := c.config.Lease
+	if ttl == 0 {
+		ttl = time.Duration(cfg.DefaultTTL) * time.Second
+	}
+	maxTTL := time.Duration(cfg.MaxTTL) * time.Second
+	if ttl < time.Second || ttl > maxTTL {
+		return 0, fmt.Errorf("租约续约窗口必须在1秒到%v之间: %v", maxTTL, ttl)
+	}
+	return ttl, nil
+}
+
+// newLeaseID 生成随机租约ID
+func newLeaseID() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("生成租约ID失败: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
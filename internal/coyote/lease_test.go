@@ -0,0 +1,64 @@
+package coyote
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckLeaseExpiry(t *testing.T) {
+	tests := []struct {
+		name      string
+		lease     bool          // 是否持有租约
+		expiresIn time.Duration // 租约剩余时间
+		rampDown  int           // lease.ramp_down(秒)
+		wantLease bool
+		wantRamp  bool
+		want      int // 检查后立即的A通道强度
+	}{
+		{name: "没有租约", rampDown: 3, want: 20},
+		{name: "租约未过期", lease: true, expiresIn: time.Second, rampDown: 3, wantLease: true, want: 20},
+		{name: "过期后渐变归零", lease: true, expiresIn: -time.Millisecond, rampDown: 3, wantRamp: true, want: 20},
+		{name: "未配置渐变时直接归零", lease: true, expiresIn: -time.Millisecond, rampDown: 0, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tickController(&frameRecorder{})
+			c.pendingA = false
+			c.config.Lease.RampDown = tt.rampDown
+			now := time.Now()
+			if tt.lease {
+				c.lease = &Lease{ID: "test", Holder: "web", TTL: time.Second, Expires: now.Add(tt.expiresIn)}
+			}
+
+			c.checkLeaseExpiry(now)
+			if got := c.lease != nil; got != tt.wantLease {
+				t.Errorf("仍持有租约 = %v, want %v", got, tt.wantLease)
+			}
+			if got := c.rampA != nil; got != tt.wantRamp {
+				t.Fatalf("A通道渐变 = %v, want %v", got, tt.wantRamp)
+			}
+			if c.rampB != nil {
+				t.Error("强度为0的B通道开始了渐变")
+			}
+			if c.channelState.AStrength != tt.want {
+				t.Errorf("A通道强度 = %d, want %d", c.channelState.AStrength, tt.want)
+			}
+			if tt.want == 0 && !c.pendingA {
+				t.Error("归零没有标记为待发送")
+			}
+
+			// 渐变在ramp_down内结束于0
+			if tt.wantRamp {
+				start := c.rampA.start
+				c.advanceRamps(start.Add(time.Duration(tt.rampDown) * time.Second / 2))
+				if got := c.channelState.AStrength; got != 10 {
+					t.Errorf("渐变中点强度 = %d, want 10", got)
+				}
+				c.advanceRamps(start.Add(time.Duration(tt.rampDown) * time.Second))
+				if c.channelState.AStrength != 0 || c.rampA != nil {
+					t.Errorf("渐变结束后 A = %d, ramp = %v", c.channelState.AStrength, c.rampA)
+				}
+			}
+		})
+	}
+}
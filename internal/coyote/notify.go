@@ -0,0 +1,79 @@
+package coyote
+
+import (
+	"log"
+	"time"
+
+	"mygodblab/internal/protocol"
+)
+
+// handleNotifications 接收设备通知消息，直到控制器关闭
+func (c *Controller) handleNotifications() {
+	notifications := c.transport.Notifications()
+	for {
+		select {
+		case <-c.stopCh:
+			return
+		case msg := <-notifications:
+			c.mu.Lock()
+			c.awaitingNotifySince = time.Time{} // 设备有回应，链路存活
+			c.mu.Unlock()
+
+			c.handleNotification(msg)
+		}
+	}
+}
+
+// handleNotification 解析单条通知消息
+func (c *Controller) handleNotification(msg []byte) {
+	if len(msg) == 0 {
+		return
+	}
+
+	switch msg[0] {
+	case 0xB1:
+		resp, err := protocol.ParseB1Response(msg)
+		if err != nil {
+			log.Printf("解析B1回应失败: %v", err)
+			return
+		}
+		c.reconcileStrength(resp)
+	default:
+		log.Printf("收到未知设备通知: %x", msg)
+	}
+}
+
+// reconcileStrength 以设备回报的实际强度为准更新本地状态
+// 设备强度可能因实体滚轮或软上限而与本地不同；尚未发出的强度变更以本地目标值为准
+func (c *Controller) reconcileStrength(resp *protocol.B1Response) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if resp.Sequence != 0 {
+		// 与等待中的变更序列号不符的回应已过期，不代表设备当前强度
+		if c.inflight == nil || resp.Sequence != c.inflight.seq {
+			return
+		}
+		c.inflight = nil // 收到确认，可以发送下一次强度变更
+	}
+
+	// 仍在等待确认的通道，设备回报的可能是变更前的值；
+	// 叠加期间设备回报的是叠加后的输出强度，不据此修改基础强度
+	skipA := c.inflight != nil && c.inflight.a || len(c.firesA) > 0
+	skipB := c.inflight != nil && c.inflight.b || len(c.firesB) > 0
+
+	deviceA, deviceB := int(resp.AStrength), int(resp.BStrength)
+	// 守卫按设备的实际强度校验之后的相对变更（滚轮调整或软上限截断后会与预期不同）
+	c.guard.SetStrength(deviceA, deviceB)
+
+	if !c.pendingA && !skipA && c.channelState.AStrength != deviceA {
+		log.Printf("A通道强度以设备为准: %d -> %d", c.channelState.AStrength, deviceA)
+		c.channelState.AStrength = deviceA
+		c.stateChanged()
+	}
+	if !c.pendingB && !skipB && c.channelState.BStrength != deviceB {
+		log.Printf("B通道强度以设备为准: %d -> %d", c.channelState.BStrength, deviceB)
+		c.channelState.BStrength = deviceB
+		c.stateChanged()
+	}
+}
@@ -0,0 +1,102 @@
+package coyote
+
+import (
+	"testing"
+	"time"
+
+	"mygodblab/internal/protocol"
+	"mygodblab/internal/transport"
+)
+
+// simController 经输出守卫连接模拟设备的控制器，组装方式与NewController相同
+// 不启动后台循环，由测试逐帧调用tick并转交设备通知
+func simController(t *testing.T) (*Controller, *transport.Simulator) {
+	t.Helper()
+	sim := transport.NewSimulator()
+	if err := sim.ScanAndConnect(0, nil); err != nil {
+		t.Fatalf("ScanAndConnect() error = %v", err)
+	}
+	c := tickController(sim)
+	c.publishGuardState()
+	c.guard = transport.NewGuard(sim, c.guardState, c.guardAlarm)
+	c.transport = c.guard
+	return c, sim
+}
+
+// nextNotification 读取模拟设备发出的下一条通知
+func nextNotification(t *testing.T, sim *transport.Simulator) []byte {
+	t.Helper()
+	select {
+	case msg := <-sim.Notifications():
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("模拟设备没有回应")
+		return nil
+	}
+}
+
+// expectB1 解析B1回应并检查序列号和A通道强度
+func expectB1(t *testing.T, msg []byte, seq byte, strength int) {
+	t.Helper()
+	resp, err := protocol.ParseB1Response(msg)
+	if err != nil {
+		t.Fatalf("ParseB1Response() error = %v", err)
+	}
+	if resp.Sequence != seq || int(resp.AStrength) != strength {
+		t.Fatalf("B1 = 序列号%d A=%d, want 序列号%d A=%d", resp.Sequence, resp.AStrength, seq, strength)
+	}
+}
+
+func TestControllerSimulatorRoundTrip(t *testing.T) {
+	c, sim := simController(t)
+
+	// 待发送的强度变更带序列号发出，设备以同一序列号回应
+	c.tick()
+	if c.inflight == nil || c.inflight.seq != 1 {
+		t.Fatalf("inflight = %+v, want 序列号1", c.inflight)
+	}
+	msg := nextNotification(t, sim)
+	expectB1(t, msg, 1, 20)
+	c.handleNotification(msg)
+	if c.inflight != nil {
+		t.Fatal("收到确认后仍在等待")
+	}
+
+	// 只改变波形的帧序列号为0，设备强度不变时不回应
+	c.tick()
+	select {
+	case msg := <-sim.Notifications():
+		t.Fatalf("强度未变时设备回应了 %x", msg)
+	default:
+	}
+
+	// 等待确认期间收到的过期回应不改变本地强度，也不结束等待
+	c.mu.Lock()
+	c.channelState.AStrength = 35
+	c.markPending("A")
+	c.mu.Unlock()
+	c.tick()
+	stale := protocol.B1Response{Sequence: 1, AStrength: 20}
+	c.handleNotification(stale.ToBytes())
+	if c.inflight == nil || c.channelState.AStrength != 35 {
+		t.Fatalf("过期回应后 inflight = %+v, A = %d", c.inflight, c.channelState.AStrength)
+	}
+	msg = nextNotification(t, sim)
+	expectB1(t, msg, 2, 35)
+	c.handleNotification(msg)
+	if c.inflight != nil || c.channelState.AStrength != 35 {
+		t.Fatalf("确认后 inflight = %+v, A = %d", c.inflight, c.channelState.AStrength)
+	}
+
+	// 设备端的强度变化（此处为软上限截断）以设备回报为准
+	bf := protocol.BFCommand{ALimit: 25, BLimit: 100, AFrequencyBalance: 160, BFrequencyBalance: 160}
+	if err := sim.WriteCharacteristic(bf.ToBytes()); err != nil {
+		t.Fatalf("写入软上限失败: %v", err)
+	}
+	msg = nextNotification(t, sim)
+	expectB1(t, msg, 0, 25)
+	c.handleNotification(msg)
+	if c.channelState.AStrength != 25 {
+		t.Errorf("设备回报后 A = %d, want 25", c.channelState.AStrength)
+	}
+}
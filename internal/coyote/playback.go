@@ -0,0 +1,118 @@
+package coyote
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"mygodblab/internal/transport"
+)
+
+// defaultUpdateInterval 默认的波形帧发送间隔，对应V3协议每条B0指令承载的100ms波形
+const defaultUpdateInterval = 100 * time.Millisecond
+
+// startPlayback 启动后台波形播放循环
+func (c *Controller) startPlayback() {
+	interval := time.Duration(c.config.Pulses.UpdateInterval) * time.Millisecond
+	if interval <= 0 {
+		interval = defaultUpdateInterval
+	}
+
+	c.stopCh = make(chan struct{})
+	c.playbackDone = make(chan struct{})
+	go c.playbackLoop(interval)
+}
+
+// stopPlayback 停止播放循环并等待其退出
+func (c *Controller) stopPlayback() {
+	if c.stopCh == nil {
+		return
+	}
+	select {
+	case <-c.stopCh:
+		// 已经停止过
+	default:
+		close(c.stopCh)
+	}
+	<-c.playbackDone
+}
+
+// playbackLoop 每个间隔发送一帧B0指令，依次播放当前波形的所有帧并循环
+func (c *Controller) playbackLoop(interval time.Duration) {
+	defer close(c.playbackDone)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stopCh:
+			return
+		case <-ticker.C:
+			c.tick()
+		}
+	}
+}
+
+// tick 构建并发送一帧B0指令，同时携带待发送的强度变更
+// 只改变波形的帧序列号为0；改变强度的帧分配序列号并等待设备确认
+func (c *Controller) tick() {
+	if !c.transport.IsConnected() {
+		return
+	}
+	// 急停锁存期间不再发送波形
+	if c.stopped.Load() {
+		return
+	}
+
+	c.mu.Lock()
+	// 连接监管完成状态同步和软上限写入后才标记为已连接，
+	// 在此之前发帧会按断线前的强度和未写入的软上限输出
+	if c.connState != StateConnected {
+		c.mu.Unlock()
+		return
+	}
+	c.checkAckTimeout()
+	now := time.Now()
+	c.advanceRamps(now)
+	c.expireFires(now)
+	c.enforcePolicy()
+	cmd := c.buildB0Command()
+	change := c.attachStrengthChange(cmd)
+	c.mu.Unlock()
+
+	err := c.sendCommand(cmd)
+	c.recordWriteResult(err)
+	if err == nil && cmd.Sequence != 0 {
+		// 带序列号的指令需要设备回应，用于检测链路是否存活
+		c.mu.Lock()
+		if c.awaitingNotifySince.IsZero() {
+			c.awaitingNotifySince = time.Now()
+		}
+		c.mu.Unlock()
+	}
+	if err != nil {
+		// 输出守卫拒绝的帧已经告警，不再逐帧记录
+		if !errors.Is(err, transport.ErrFrameRejected) {
+			log.Printf("发送波形帧失败: %v", err)
+		}
+
+		// 发送失败时保留强度变更，下一帧重试
+		c.mu.Lock()
+		if change != nil && c.inflight == change {
+			c.releaseInflight()
+		}
+		c.mu.Unlock()
+	}
+}
+
+// markPending 标记通道强度需要在下一帧发送，调用方需持有写锁
+func (c *Controller) markPending(channel string) {
+	switch channel {
+	case "A", "a":
+		c.pendingA = true
+	case "B", "b":
+		c.pendingB = true
+	}
+	c.stateChanged()
+}
@@ -0,0 +1,77 @@
+package coyote
+
+import (
+	"testing"
+	"time"
+
+	"mygodblab/internal/config"
+	"mygodblab/internal/policy"
+	"mygodblab/internal/pulse"
+	"mygodblab/internal/transport"
+)
+
+// frameRecorder 始终处于连接状态、记录写入帧的传输层
+type frameRecorder struct {
+	transport.Transport
+	writes [][]byte
+}
+
+func (r *frameRecorder) IsConnected() bool { return true }
+
+func (r *frameRecorder) WriteCharacteristic(data []byte) error {
+	r.writes = append(r.writes, data)
+	return nil
+}
+
+// tickController 已连接、A通道强度20等待发送的控制器，帧写入tr
+func tickController(tr transport.Transport) *Controller {
+	cfg := config.DefaultConfig()
+	engine, _ := policy.NewEngine(nil)
+	return &Controller{
+		config:       cfg,
+		transport:    tr,
+		pulseManager: pulse.NewDefaultManager(),
+		channelState: &ChannelState{
+			AStrength: 20,
+			ALimit:    100,
+			BLimit:    100,
+			APulse:    cfg.Pulses.DefaultPulse,
+			BPulse:    cfg.Pulses.DefaultPulse,
+			AEnabled:  true,
+			BEnabled:  true,
+		},
+		pendingA:     true,
+		sequence:     1,
+		connState:    StateConnected,
+		batteryCap:   noStrengthCap,
+		commandTimes: make(map[string][]time.Time),
+		policy:       engine,
+	}
+}
+
+func TestTickWaitsForConnected(t *testing.T) {
+	tests := []struct {
+		state      ConnectionState
+		wantFrames int
+	}{
+		{StateScanning, 0},
+		{StateReconnecting, 0},
+		{StateDisconnected, 0},
+		{StateConnected, 1},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.state), func(t *testing.T) {
+			tr := &frameRecorder{}
+			c := tickController(tr)
+			c.connState = tt.state
+
+			c.tick()
+			if len(tr.writes) != tt.wantFrames {
+				t.Errorf("写入%d帧, want %d", len(tr.writes), tt.wantFrames)
+			}
+			if tt.wantFrames == 0 && !c.pendingA {
+				t.Error("未发送的强度变更被清除")
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package coyote
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"mygodblab/internal/config"
+	"mygodblab/internal/policy"
+)
+
+// Caller 指令来源，策略规则和速率限制据此区分客户端
+type Caller struct {
+	Client    string // 客户端标识
+	Confirmed bool   // 客户端已确认超过确认阈值的强度
+}
+
+// ConfirmationRequired 操作超过确认阈值，需要用户确认后以 Confirmed 重新提交
+type ConfirmationRequired struct {
+	Rule   string // 要求确认的规则名
+	Reason string // 需要确认的原因
+}
+
+func (e *ConfirmationRequired) Error() string {
+	return e.Reason
+}
+
+// denialError 把策略拒绝转换为错误，需要确认的拒绝返回 *ConfirmationRequired
+func denialError(decision policy.Decision) error {
+	if decision.NeedsConfirm {
+		return &ConfirmationRequired{Rule: decision.Rule, Reason: decision.Reason}
+	}
+	return fmt.Errorf("%s", decision.Reason)
+}
+
+// ConsoleCaller 本地控制台，操作者就在设备旁，视为已确认
+var ConsoleCaller = Caller{Client: ClientConsole, Confirmed: true}
+
+// loadPolicy 加载策略文件，文件不存在时只使用内置规则
+// 文件无法解析或规则无效时返回错误，不能让写错的策略文件悄悄去掉用户设置的上限
+// 配置了 policy.confirm_above 时追加对应的舒适阈值规则，不依赖策略文件
+func loadPolicy(cfg config.PolicyConfig) (*policy.Engine, error) {
+	var rules []policy.Rule
+	engine, err := policy.LoadEngine(cfg.ConfigPath)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		log.Printf("策略文件%s不存在，只使用内置规则", cfg.ConfigPath)
+	case err != nil:
+		return nil, fmt.Errorf("加载策略文件%s失败: %w", cfg.ConfigPath, err)
+	default:
+		rules = engine.Rules()
+		log.Printf("已加载%d条策略规则", len(rules))
+	}
+
+	if cfg.ConfirmAbove > 0 {
+		rules = append(rules, policy.Rule{
+			Name:      "confirm_above",
+			Type:      policy.RuleConfirmAbove,
+			Threshold: cfg.ConfirmAbove,
+		})
+		log.Printf("强度超过%d时需要用户确认", cfg.ConfirmAbove)
+	}
+	return policy.NewEngine(rules)
+}
+
+// evaluate 以通道当前状态构建策略请求并评估，调用方需持有锁
+// pulseID为空时使用通道当前波形
+func (c *Controller) evaluate(action policy.Action, caller Caller, channel string, target int, pulseID string) policy.Decision {
+	if pulseID == "" {
+		pulseID = c.currentPulse(channel)
+	}
+	return c.evaluateFrom(action, caller, channel, c.currentStrength(channel), target, pulseID)
+}
+
+// evaluateFrom 以指定的当前强度评估，用于叠加后的输出强度，调用方需持有锁
+func (c *Controller) evaluateFrom(action policy.Action, caller Caller, channel string, current, target int, pulseID string) policy.Decision {
+	return c.policy.Evaluate(c.policyRequest(action, caller, channel, current, target, pulseID))
+}
+
+// policyRequest 以通道当前的启用状态、上限和电量限制构建策略请求，调用方需持有锁
+func (c *Controller) policyRequest(action policy.Action, caller Caller, channel string, current, target int, pulseID string) policy.Request {
+	now := time.Now()
+	return policy.Request{
+		Action:    action,
+		Client:    caller.Client,
+		Channel:   channel,
+		Current:   current,
+		Target:    target,
+		Pulse:     pulseID,
+		Confirmed: caller.Confirmed,
+		Time:      now,
+		Enabled:   c.channelEnabled(channel),
+		Limit:     c.currentLimit(channel),
+		Cap:       c.batteryCap,
+		Cooldown:  remainingUntil(now, c.session.cooldownUntil),
+	}
+}
+
+// applyStrength 经策略和速率限制后设置通道强度，调用方需持有写锁
+// 所有改变强度的指令都经过这里
+func (c *Controller) applyStrength(action policy.Action, caller Caller, channel string, target int) (StrengthResult, error) {
+	result := StrengthResult{Channel: channel, Requested: target}
+
+	decision := c.evaluate(action, caller, channel, target, "")
+	if !decision.Allowed {
+		return result, denialError(decision)
+	}
+	if decision.Rule != "" {
+		result.note("规则%s: %s，调整为%d", decision.Rule, decision.Reason, decision.Strength)
+	}
+
+	if err := c.checkCommandRate(caller.Client, channel, c.currentStrength(channel), decision.Strength); err != nil {
+		return result, err
+	}
+
+	// 限制提升速率
+	strength, err := c.limitIncrease(channel, c.currentStrength(channel), decision.Strength, &result)
+	if err != nil {
+		return result, err
+	}
+
+	// 直接设置强度会取代正在进行的渐变
+	c.cancelRamp(channel)
+	c.setCurrentStrength(channel, strength)
+	result.Applied = strength
+
+	// 标记待发送，由播放循环在下一帧携带强度变更
+	c.markPending(channel)
+	return result, nil
+}
+
+// reviewStrength 不改变强度的操作（更换波形、启用通道、设置平衡参数）按新状态评估当前强度，
+// 规则要求时调低强度，调用方需持有写锁；pulseID为空时使用通道当前波形
+func (c *Controller) reviewStrength(action policy.Action, channel, pulseID string) error {
+	current := c.currentStrength(channel)
+	decision := c.evaluate(action, Caller{}, channel, current, pulseID)
+	if !decision.Allowed {
+		return denialError(decision)
+	}
+	if decision.Strength < current {
+		c.cancelRamp(channel)
+		c.setCurrentStrength(channel, decision.Strength)
+		c.markPending(channel)
+	}
+	return nil
+}
+
+// enforcePolicy 发帧前按策略复核当前强度，规则生效（如进入安静时段）时调低，调用方需持有写锁
+func (c *Controller) enforcePolicy() {
+	for _, channel := range []string{"A", "B"} {
+		current := c.currentStrength(channel)
+		decision := c.evaluate(policy.ActionEnforce, Caller{}, channel, current, "")
+		if decision.Strength < current {
+			c.cancelRamp(channel)
+			c.setCurrentStrength(channel, decision.Strength)
+			c.markPending(channel)
+		}
+		c.trimFires(channel)
+	}
+}
+
+// normalizeChannel 将通道名统一为大写A/B
+func normalizeChannel(channel string) (string, error) {
+	switch strings.ToUpper(channel) {
+	case "A":
+		return "A", nil
+	case "B":
+		return "B", nil
+	}
+	return "", fmt.Errorf("无效的通道: %s", channel)
+}
+
+// currentPulse 返回通道当前波形，调用方需持有锁
+func (c *Controller) currentPulse(channel string) string {
+	if channel == "B" || channel == "b" {
+		return c.channelState.BPulse
+	}
+	return c.channelState.APulse
+}
+
+// channelEnabled 返回通道是否启用，调用方需持有锁
+func (c *Controller) channelEnabled(channel string) bool {
+	if channel == "B" || channel == "b" {
+		return c.channelState.BEnabled
+	}
+	return c.channelState.AEnabled
+}
+
+// currentLimit 返回通道上限，调用方需持有锁
+func (c *Controller) currentLimit(channel string) int {
+	if channel == "B" || channel == "b" {
+		return c.channelState.BLimit
+	}
+	return c.channelState.ALimit
+}
@@ -0,0 +1,51 @@
+package coyote
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"mygodblab/internal/config"
+)
+
+func TestLoadPolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string // 为空时不创建文件
+		confirm   int    // policy.confirm_above
+		wantRules int
+		wantErr   bool
+	}{
+		{name: "文件不存在"},
+		{name: "文件不存在时追加舒适阈值", confirm: 80, wantRules: 1},
+		{name: "文件规则之后追加舒适阈值", content: "rules:\n  - type: ceiling\n    max: 60\n", confirm: 80, wantRules: 2},
+		{name: "合法规则", content: "rules:\n  - type: ceiling\n    max: 60\n", wantRules: 1},
+		{name: "无法解析", content: "rules: [\n", wantErr: true},
+		{name: "规则无效", content: "rules:\n  - type: no_such_rule\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "policy.yaml")
+			if tt.content != "" {
+				if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			engine, err := loadPolicy(config.PolicyConfig{ConfigPath: path, ConfirmAbove: tt.confirm})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("loadPolicy() 没有返回错误")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadPolicy() error = %v", err)
+			}
+			if got := len(engine.Rules()); got != tt.wantRules {
+				t.Errorf("加载了%d条规则, want %d", got, tt.wantRules)
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package coyote
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"mygodblab/internal/policy"
+)
+
+// RampCurve 强度渐变曲线
+type RampCurve string
+
+const (
+	RampLinear      RampCurve = "linear"      // 线性：匀速变化
+	RampEaseIn      RampCurve = "ease-in"     // 先慢后快（二次曲线）
+	RampExponential RampCurve = "exponential" // 指数：起始极慢，接近终点时加速
+)
+
+// ParseRampCurve 解析渐变曲线名称，空字符串表示线性
+func ParseRampCurve(name string) (RampCurve, error) {
+	switch RampCurve(name) {
+	case "", RampLinear:
+		return RampLinear, nil
+	case RampEaseIn, RampExponential:
+		return RampCurve(name), nil
+	default:
+		return "", fmt.Errorf("无效的渐变曲线: %s（可选 linear、ease-in、exponential）", name)
+	}
+}
+
+// apply 将时间进度(0-1)映射为强度进度(0-1)
+func (rc RampCurve) apply(progress float64) float64 {
+	switch rc {
+	case RampEaseIn:
+		return progress * progress
+	case RampExponential:
+		// 2^(10p) 归一化到 [0,1]
+		return (math.Pow(2, 10*progress) - 1) / 1023
+	default:
+		return progress
+	}
+}
+
+// ramp 单个通道正在进行的强度渐变
+type ramp struct {
+	from     int           // 起始强度
+	to       int           // 目标强度
+	start    time.Time     // 开始时间
+	duration time.Duration // 持续时间
+	curve    RampCurve     // 渐变曲线
+}
+
+// valueAt 计算某时刻的强度，done表示渐变已结束
+func (r *ramp) valueAt(now time.Time) (value int, done bool) {
+	progress := float64(now.Sub(r.start)) / float64(r.duration)
+	if progress >= 1 {
+		return r.to, true
+	}
+	if progress < 0 {
+		progress = 0
+	}
+	delta := float64(r.to-r.from) * r.curve.apply(progress)
+	return r.from + int(math.Round(delta)), false
+}
+
+// RampStrength 在duration内按曲线将通道强度渐变到目标值
+// 播放循环每帧推进一步；同一通道新的渐变或直接设置强度会取代正在进行的渐变
+// 渐变目标经过策略评估，返回实际的渐变目标和用时，受规则或速率限制调整时在结果中说明
+func (c *Controller) RampStrength(caller Caller, channel string, target int, duration time.Duration, curve RampCurve) (StrengthResult, error) {
+	result := StrengthResult{Channel: channel, Requested: target}
+	if err := c.checkStrengthCommand(); err != nil {
+		return result, err
+	}
+	if duration <= 0 {
+		return c.SetStrength(caller, channel, target)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	channel, err := normalizeChannel(channel)
+	if err != nil {
+		return result, err
+	}
+	result.Channel = channel
+
+	decision := c.evaluate(policy.ActionRampStrength, caller, channel, target, "")
+	if !decision.Allowed {
+		return result, denialError(decision)
+	}
+	if decision.Rule != "" {
+		result.note("规则%s: %s，目标调整为%d", decision.Rule, decision.Reason, decision.Strength)
+	}
+	target = decision.Strength
+
+	if err := c.checkCommandRate(caller.Client, channel, c.currentStrength(channel), target); err != nil {
+		return result, err
+	}
+
+	from := c.currentStrength(channel)
+	duration, err = c.limitRampRate(channel, from, target, duration, &result)
+	if err != nil {
+		return result, err
+	}
+
+	r := &ramp{
+		from:     from,
+		to:       target,
+		start:    time.Now(),
+		duration: duration,
+		curve:    curve,
+	}
+
+	if *c.rampSlot(channel) != nil {
+		log.Printf("%s通道新的渐变取代了正在进行的渐变", channel)
+	}
+	*c.rampSlot(channel) = r
+	result.Applied = target
+	result.Duration = duration
+
+	log.Printf("%s通道强度渐变: %d -> %d，用时%v，曲线%s", channel, r.from, r.to, duration, curve)
+	return result, nil
+}
+
+// CancelRamp 取消通道正在进行的渐变，强度停留在当前值；channel为空时取消两个通道
+func (c *Controller) CancelRamp(channel string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch channel {
+	case "", "AB", "ab":
+		c.cancelRamp("A")
+		c.cancelRamp("B")
+	case "A", "a", "B", "b":
+		c.cancelRamp(channel)
+	default:
+		return fmt.Errorf("无效的通道: %s", channel)
+	}
+	return nil
+}
+
+// SetStrengthSmooth 设置通道强度，向上跳变超过 ramp.auto_delta 时按 ramp.auto_rate 渐变
+// 结果的Duration为渐变用时，直接设置时为0
+func (c *Controller) SetStrengthSmooth(caller Caller, channel string, strength int) (StrengthResult, error) {
+	cfg := c.config.Ramp
+
+	c.mu.RLock()
+	current := c.currentStrength(channel)
+	c.mu.RUnlock()
+
+	delta := strength - current
+	if cfg.AutoDelta <= 0 || delta <= cfg.AutoDelta {
+		return c.SetStrength(caller, channel, strength)
+	}
+
+	curve, err := ParseRampCurve(cfg.AutoCurve)
+	if err != nil {
+		return StrengthResult{Channel: channel, Requested: strength}, err
+	}
+	duration := time.Duration(delta) * time.Second / time.Duration(cfg.AutoRate)
+	return c.RampStrength(caller, channel, strength, duration, curve)
+}
+
+// cancelRamp 取消单个通道的渐变，调用方需持有写锁
+func (c *Controller) cancelRamp(channel string) {
+	slot := c.rampSlot(channel)
+	if slot != nil && *slot != nil {
+		*slot = nil
+		log.Printf("%s通道渐变已取消", channel)
+	}
+}
+
+// advanceRamps 推进正在进行的渐变，由播放循环每帧调用，调用方需持有写锁
+func (c *Controller) advanceRamps(now time.Time) {
+	for _, channel := range []string{"A", "B"} {
+		slot := c.rampSlot(channel)
+		if *slot == nil {
+			continue
+		}
+
+		// 渐变过程中上限或策略可能收紧，由随后的策略复核调低
+		value, done := (*slot).valueAt(now)
+		if value != c.currentStrength(channel) {
+			c.setCurrentStrength(channel, value)
+			c.markPending(channel)
+		}
+		if done {
+			*slot = nil
+			log.Printf("%s通道渐变完成，强度: %d", channel, value)
+		}
+	}
+}
+
+// rampSlot 返回通道对应的渐变存放位置，无效通道返回nil
+func (c *Controller) rampSlot(channel string) **ramp {
+	switch channel {
+	case "A", "a":
+		return &c.rampA
+	case "B", "b":
+		return &c.rampB
+	}
+	return nil
+}
+
+// currentStrength 返回通道当前强度，调用方需持有锁
+func (c *Controller) currentStrength(channel string) int {
+	if channel == "B" || channel == "b" {
+		return c.channelState.BStrength
+	}
+	return c.channelState.AStrength
+}
+
+// setCurrentStrength 更新通道当前强度，调用方需持有写锁
+func (c *Controller) setCurrentStrength(channel string, strength int) {
+	if channel == "B" || channel == "b" {
+		c.channelState.BStrength = strength
+		return
+	}
+	c.channelState.AStrength = strength
+}
@@ -0,0 +1,77 @@
+package coyote
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRampCurveApply(t *testing.T) {
+	tests := []struct {
+		curve    RampCurve
+		progress float64
+		want     float64
+	}{
+		{RampLinear, 0, 0},
+		{RampLinear, 0.25, 0.25},
+		{RampLinear, 1, 1},
+		{RampEaseIn, 0.5, 0.25},
+		{RampEaseIn, 1, 1},
+		{RampExponential, 0, 0},
+		{RampExponential, 0.5, 31.0 / 1023},
+		{RampExponential, 1, 1},
+	}
+	for _, tt := range tests {
+		if got := tt.curve.apply(tt.progress); got != tt.want {
+			t.Errorf("%s.apply(%v) = %v, want %v", tt.curve, tt.progress, got, tt.want)
+		}
+	}
+}
+
+func TestRampValueAt(t *testing.T) {
+	start := time.Now()
+	tests := []struct {
+		name     string
+		r        ramp
+		elapsed  time.Duration
+		want     int
+		wantDone bool
+	}{
+		{"线性起点", ramp{from: 0, to: 100, duration: 10 * time.Second, curve: RampLinear}, 0, 0, false},
+		{"线性中点", ramp{from: 0, to: 100, duration: 10 * time.Second, curve: RampLinear}, 5 * time.Second, 50, false},
+		{"线性向下", ramp{from: 80, to: 20, duration: 4 * time.Second, curve: RampLinear}, time.Second, 65, false},
+		{"先慢后快", ramp{from: 0, to: 100, duration: 10 * time.Second, curve: RampEaseIn}, 5 * time.Second, 25, false},
+		{"到期返回目标", ramp{from: 0, to: 100, duration: 10 * time.Second, curve: RampExponential}, 10 * time.Second, 100, true},
+		{"超时返回目标", ramp{from: 30, to: 0, duration: time.Second, curve: RampLinear}, 2 * time.Second, 0, true},
+		{"开始之前取起点", ramp{from: 30, to: 60, duration: time.Second, curve: RampLinear}, -time.Second, 30, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := tt.r
+			r.start = start
+			got, done := r.valueAt(start.Add(tt.elapsed))
+			if got != tt.want || done != tt.wantDone {
+				t.Errorf("valueAt() = %d, %v, want %d, %v", got, done, tt.want, tt.wantDone)
+			}
+		})
+	}
+}
+
+func TestParseRampCurve(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    RampCurve
+		wantErr bool
+	}{
+		{"", RampLinear, false},
+		{"linear", RampLinear, false},
+		{"ease-in", RampEaseIn, false},
+		{"exponential", RampExponential, false},
+		{"bounce", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRampCurve(tt.name)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseRampCurve(%q) = %q, %v", tt.name, got, err)
+		}
+	}
+}
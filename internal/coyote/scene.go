@@ -0,0 +1,261 @@
+package coyote
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"mygodblab/internal/config"
+	"mygodblab/internal/policy"
+	"mygodblab/internal/scene"
+)
+
+// SceneResult 加载场景的实际执行结果
+type SceneResult struct {
+	Name    string           // 场景名称
+	Changes []string         // 启用状态、上限和波形的变更
+	Results []StrengthResult // 各通道强度的渐变结果
+}
+
+// String 描述实际执行的结果
+func (r SceneResult) String() string {
+	parts := []string{fmt.Sprintf("已加载场景%s", r.Name)}
+	parts = append(parts, r.Changes...)
+	for _, result := range r.Results {
+		parts = append(parts, result.String())
+	}
+	return strings.Join(parts, "；")
+}
+
+// loadScenes 加载场景文件，文件无法解析时场景功能不可用，避免保存时覆盖原文件
+func loadScenes(cfg config.SceneConfig) *scene.Store {
+	store, err := scene.NewStore(cfg.ConfigPath)
+	if err != nil {
+		log.Printf("加载场景失败，场景功能不可用: %v", err)
+		return nil
+	}
+	return store
+}
+
+// SaveScene 将两个通道当前的启用状态、上限、基础强度和波形保存为场景，同名场景被覆盖
+// 临时叠加不属于基础状态，不会被保存
+func (c *Controller) SaveScene(name string) (scene.Scene, error) {
+	if c.scenes == nil {
+		return scene.Scene{}, fmt.Errorf("场景文件加载失败，场景功能不可用")
+	}
+
+	c.mu.RLock()
+	s := scene.Scene{
+		Name:     name,
+		AChannel: c.sceneChannel("A"),
+		BChannel: c.sceneChannel("B"),
+		SavedAt:  time.Now(),
+	}
+	c.mu.RUnlock()
+
+	if err := c.scenes.Save(s); err != nil {
+		return s, err
+	}
+	log.Printf("已保存场景%s: A=%d/%d %s B=%d/%d %s", name,
+		s.AChannel.Strength, s.AChannel.Limit, s.AChannel.Pulse,
+		s.BChannel.Strength, s.BChannel.Limit, s.BChannel.Pulse)
+	return s, nil
+}
+
+// LoadScene 加载场景：按场景设置通道启用状态、上限和波形，强度按 ramp.auto_rate 渐变到场景中的值
+// 上限、波形和强度都和单独调用时一样经过安全策略和速率限制，不会直接跳变到场景强度
+// 两个通道的目标强度先一起评估，任一通道被拒绝时都不改变；应用中途失败时已改变的通道恢复为加载前的设置
+func (c *Controller) LoadScene(caller Caller, name string) (SceneResult, error) {
+	result := SceneResult{Name: name}
+	if c.scenes == nil {
+		return result, fmt.Errorf("场景文件加载失败，场景功能不可用")
+	}
+	s, err := c.scenes.Get(name)
+	if err != nil {
+		return result, err
+	}
+	if err := c.checkStrengthCommand(); err != nil {
+		return result, err
+	}
+
+	// 先校验整个场景，避免只应用了一半
+	channels := map[string]scene.Channel{"A": s.AChannel, "B": s.BChannel}
+	for _, channel := range []string{"A", "B"} {
+		ch := channels[channel]
+		if !ch.Enabled {
+			continue
+		}
+		if ch.Limit < 0 || ch.Limit > 200 || ch.Strength < 0 || ch.Strength > 200 {
+			return result, fmt.Errorf("场景%s的%s通道上限或强度超出范围0-200", name, channel)
+		}
+		if ch.Pulse != "" {
+			if _, err := c.pulseManager.GetPulse(ch.Pulse); err != nil {
+				return result, fmt.Errorf("场景%s的%s通道: %w", name, channel, err)
+			}
+		}
+	}
+
+	curve, err := ParseRampCurve(c.config.Ramp.AutoCurve)
+	if err != nil {
+		return result, err
+	}
+
+	c.mu.RLock()
+	err = c.previewScene(caller, channels)
+	before := map[string]scene.Channel{"A": c.sceneChannel("A"), "B": c.sceneChannel("B")}
+	c.mu.RUnlock()
+	if err != nil {
+		return result, err
+	}
+
+	for i, channel := range []string{"A", "B"} {
+		if err := c.applySceneChannel(caller, channel, channels[channel], curve, &result); err != nil {
+			for _, applied := range []string{"A", "B"}[:i+1] {
+				c.restoreSceneChannel(applied, before[applied])
+			}
+			return result, fmt.Errorf("加载场景%s失败，已恢复加载前的通道设置: %w", name, err)
+		}
+	}
+
+	log.Printf("已加载场景%s", name)
+	return result, nil
+}
+
+// previewScene 按场景设置后的启用状态、上限和波形评估两个通道的目标强度，调用方需持有锁
+// 任一通道被策略拒绝（包括需要确认）时返回错误，此时两个通道都还没有改变
+func (c *Controller) previewScene(caller Caller, channels map[string]scene.Channel) error {
+	for _, channel := range []string{"A", "B"} {
+		ch := channels[channel]
+		if !ch.Enabled {
+			continue
+		}
+		pulseID := ch.Pulse
+		if pulseID == "" {
+			pulseID = c.currentPulse(channel)
+		}
+		req := c.policyRequest(policy.ActionRampStrength, caller, channel, c.currentStrength(channel), ch.Strength, pulseID)
+		req.Enabled = true
+		req.Limit = ch.Limit
+		if decision := c.policy.Evaluate(req); !decision.Allowed {
+			return fmt.Errorf("%s通道: %w", channel, denialError(decision))
+		}
+	}
+	return nil
+}
+
+// applySceneChannel 按场景设置一个通道，实际的变更记录到result
+func (c *Controller) applySceneChannel(caller Caller, channel string, ch scene.Channel, curve RampCurve, result *SceneResult) error {
+	c.mu.RLock()
+	enabled := c.channelEnabled(channel)
+	limit := c.currentLimit(channel)
+	pulseID := c.currentPulse(channel)
+	current := c.currentStrength(channel)
+	c.mu.RUnlock()
+
+	if !ch.Enabled {
+		if enabled {
+			if err := c.SetChannelEnabled(channel, false); err != nil {
+				return err
+			}
+			result.Changes = append(result.Changes, fmt.Sprintf("%s通道已禁用", channel))
+		}
+		return nil
+	}
+
+	if !enabled {
+		if err := c.SetChannelEnabled(channel, true); err != nil {
+			return err
+		}
+		result.Changes = append(result.Changes, fmt.Sprintf("%s通道已启用", channel))
+	}
+	if ch.Limit != limit {
+		if err := c.SetLimit(channel, ch.Limit); err != nil {
+			return err
+		}
+		// 上限可能被策略调整，记录实际生效的值
+		c.mu.RLock()
+		limit = c.currentLimit(channel)
+		c.mu.RUnlock()
+		result.Changes = append(result.Changes, fmt.Sprintf("%s通道上限%d", channel, limit))
+	}
+	if ch.Pulse != "" && ch.Pulse != pulseID {
+		if err := c.SetPulse(channel, ch.Pulse); err != nil {
+			return err
+		}
+		result.Changes = append(result.Changes, fmt.Sprintf("%s通道波形%s", channel, ch.Pulse))
+	}
+
+	delta := ch.Strength - current
+	if delta < 0 {
+		delta = -delta
+	}
+	duration := time.Duration(delta) * time.Second / time.Duration(c.config.Ramp.AutoRate)
+	strength, err := c.RampStrength(caller, channel, ch.Strength, duration, curve)
+	if err != nil {
+		return err
+	}
+	result.Results = append(result.Results, strength)
+	return nil
+}
+
+// restoreSceneChannel 把通道恢复为加载场景前的启用状态、上限和波形
+// 取消场景开始的渐变，强度只降低到不超过加载前的值，不会因恢复而提升输出
+func (c *Controller) restoreSceneChannel(channel string, before scene.Channel) {
+	c.mu.Lock()
+	c.cancelRamp(channel)
+	if c.currentStrength(channel) > before.Strength {
+		c.setCurrentStrength(channel, before.Strength)
+		c.markPending(channel)
+	}
+	enabled := c.channelEnabled(channel)
+	limit := c.currentLimit(channel)
+	pulseID := c.currentPulse(channel)
+	c.mu.Unlock()
+
+	var err error
+	if enabled != before.Enabled {
+		err = c.SetChannelEnabled(channel, before.Enabled)
+	}
+	if err == nil && limit != before.Limit {
+		err = c.SetLimit(channel, before.Limit)
+	}
+	if err == nil && before.Pulse != "" && pulseID != before.Pulse {
+		err = c.SetPulse(channel, before.Pulse)
+	}
+	if err != nil {
+		log.Printf("恢复%s通道加载场景前的设置失败: %v", channel, err)
+		return
+	}
+	log.Printf("%s通道已恢复加载场景前的设置", channel)
+}
+
+// ListScenes 列出所有已保存的场景
+func (c *Controller) ListScenes() ([]scene.Scene, error) {
+	if c.scenes == nil {
+		return nil, fmt.Errorf("场景文件加载失败，场景功能不可用")
+	}
+	return c.scenes.List(), nil
+}
+
+// DeleteScene 删除场景
+func (c *Controller) DeleteScene(name string) error {
+	if c.scenes == nil {
+		return fmt.Errorf("场景文件加载失败，场景功能不可用")
+	}
+	if err := c.scenes.Delete(name); err != nil {
+		return err
+	}
+	log.Printf("已删除场景%s", name)
+	return nil
+}
+
+// sceneChannel 通道当前的基础状态，调用方需持有锁
+func (c *Controller) sceneChannel(channel string) scene.Channel {
+	return scene.Channel{
+		Enabled:  c.channelEnabled(channel),
+		Limit:    c.currentLimit(channel),
+		Strength: c.currentStrength(channel),
+		Pulse:    c.currentPulse(channel),
+	}
+}
@@ -0,0 +1,77 @@
+package coyote
+
+import (
+	"log"
+	"time"
+
+	"mygodblab/internal/protocol"
+)
+
+// ackTimeout 等待设备B1确认的超时时间，超时后重新发送强度变更
+const ackTimeout = time.Second
+
+// inflightChange 已发出、等待设备确认的强度变更
+// V3协议规定：带非0序列号的强度变更在收到对应B1回应前，不能再发送新的强度变更
+type inflightChange struct {
+	seq    byte      // 指令序列号(1-15)
+	a, b   bool      // 该指令改变了哪些通道
+	sentAt time.Time // 发出时间
+}
+
+// nextSequence 分配下一个序列号(1-15)，调用方需持有写锁
+func (c *Controller) nextSequence() byte {
+	seq := c.sequence
+	c.sequence++
+	// 序列号超过15则重置为1（序列号范围：1-15，0表示不需要回应）
+	if c.sequence > 15 {
+		c.sequence = 1
+	}
+	return seq
+}
+
+// attachStrengthChange 把待发送的强度变更写入指令并分配序列号，调用方需持有写锁
+// 已有变更等待确认时不附加，待发送的变更保留到确认后合并为一次绝对设置
+func (c *Controller) attachStrengthChange(cmd *protocol.B0Command) *inflightChange {
+	if c.inflight != nil || (!c.pendingA && !c.pendingB) {
+		return nil
+	}
+
+	change := &inflightChange{
+		seq:    c.nextSequence(),
+		a:      c.pendingA,
+		b:      c.pendingB,
+		sentAt: time.Now(),
+	}
+	cmd.Sequence = change.seq
+	if change.a {
+		cmd.AMode = protocol.StrengthModeAbsolute
+		cmd.AStrength = byte(c.outputStrength("A"))
+	}
+	if change.b {
+		cmd.BMode = protocol.StrengthModeAbsolute
+		cmd.BStrength = byte(c.outputStrength("B"))
+	}
+
+	c.pendingA, c.pendingB = false, false
+	c.inflight = change
+	return change
+}
+
+// releaseInflight 放弃等待中的变更并把它的通道重新标记为待发送，调用方需持有写锁
+// 强度变更使用绝对设置，重发不会造成重复增减
+func (c *Controller) releaseInflight() {
+	if c.inflight == nil {
+		return
+	}
+	c.pendingA = c.pendingA || c.inflight.a
+	c.pendingB = c.pendingB || c.inflight.b
+	c.inflight = nil
+}
+
+// checkAckTimeout 等待确认超时则重新发送，调用方需持有写锁
+func (c *Controller) checkAckTimeout() {
+	if c.inflight != nil && time.Since(c.inflight.sentAt) > ackTimeout {
+		log.Printf("序列号%d的强度变更未收到设备确认，重新发送", c.inflight.seq)
+		c.releaseInflight()
+	}
+}
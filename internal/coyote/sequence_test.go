@@ -0,0 +1,108 @@
+package coyote
+
+import (
+	"testing"
+	"time"
+
+	"mygodblab/internal/protocol"
+)
+
+func TestAttachStrengthChange(t *testing.T) {
+	tests := []struct {
+		name     string
+		inflight *inflightChange
+		pendingA bool
+		sequence byte
+		wantSeq  byte // 0表示不附加强度变更
+		wantNext byte
+	}{
+		{name: "没有待发送的变更", sequence: 3, wantNext: 3},
+		{name: "附加变更并分配序列号", pendingA: true, sequence: 3, wantSeq: 3, wantNext: 4},
+		{name: "序列号15之后回到1", pendingA: true, sequence: 15, wantSeq: 15, wantNext: 1},
+		{name: "等待确认期间不附加", inflight: &inflightChange{seq: 2, a: true, sentAt: time.Now()}, pendingA: true, sequence: 3, wantNext: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tickController(&frameRecorder{})
+			c.inflight = tt.inflight
+			c.pendingA = tt.pendingA
+			c.sequence = tt.sequence
+
+			cmd := c.buildB0Command()
+			change := c.attachStrengthChange(cmd)
+			if cmd.Sequence != tt.wantSeq {
+				t.Errorf("Sequence = %d, want %d", cmd.Sequence, tt.wantSeq)
+			}
+			if c.sequence != tt.wantNext {
+				t.Errorf("下一个序列号 = %d, want %d", c.sequence, tt.wantNext)
+			}
+			if tt.wantSeq == 0 {
+				if change != nil || c.pendingA != tt.pendingA {
+					t.Errorf("change = %+v, pendingA = %v, want 不附加且保留待发送", change, c.pendingA)
+				}
+				return
+			}
+			if change == nil || c.inflight != change || c.pendingA {
+				t.Fatalf("change = %+v, inflight = %+v, pendingA = %v", change, c.inflight, c.pendingA)
+			}
+			if cmd.AMode != protocol.StrengthModeAbsolute || cmd.AStrength != 20 {
+				t.Errorf("A通道 mode = %d strength = %d, want 绝对设置20", cmd.AMode, cmd.AStrength)
+			}
+		})
+	}
+}
+
+func TestCheckAckTimeout(t *testing.T) {
+	tests := []struct {
+		name         string
+		sentAgo      time.Duration
+		wantInflight bool
+	}{
+		{"等待确认中", ackTimeout / 2, true},
+		{"确认超时后重发", 2 * ackTimeout, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tickController(&frameRecorder{})
+			c.pendingA = false
+			c.inflight = &inflightChange{seq: 5, a: true, sentAt: time.Now().Add(-tt.sentAgo)}
+
+			c.checkAckTimeout()
+			if got := c.inflight != nil; got != tt.wantInflight {
+				t.Fatalf("仍在等待 = %v, want %v", got, tt.wantInflight)
+			}
+			// 超时放弃的变更重新标记为待发送，下一帧以绝对值重发
+			if c.pendingA == tt.wantInflight {
+				t.Errorf("pendingA = %v", c.pendingA)
+			}
+		})
+	}
+}
+
+func TestTickRetriesAfterAckTimeout(t *testing.T) {
+	tr := &frameRecorder{}
+	c := tickController(tr)
+
+	c.tick()
+	first := c.inflight
+	if first == nil {
+		t.Fatal("强度变更没有等待确认")
+	}
+	c.tick()
+	if c.inflight != first {
+		t.Fatal("等待确认期间发出了新的强度变更")
+	}
+
+	first.sentAt = time.Now().Add(-2 * ackTimeout)
+	c.tick()
+	if c.inflight == nil || c.inflight.seq == first.seq {
+		t.Fatalf("确认超时后 inflight = %+v, want 新序列号", c.inflight)
+	}
+	last, err := protocol.ParseB0Command(tr.writes[len(tr.writes)-1])
+	if err != nil {
+		t.Fatalf("ParseB0Command() error = %v", err)
+	}
+	if last.Sequence != c.inflight.seq || last.AMode != protocol.StrengthModeAbsolute || last.AStrength != 20 {
+		t.Errorf("重发的帧 = %+v", last)
+	}
+}
@@ -0,0 +1,220 @@
+package coyote
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// sessionCheckInterval 会话计时检查间隔
+const sessionCheckInterval = 500 * time.Millisecond
+
+// Unlimited 表示未配置该项限制
+const Unlimited time.Duration = -1
+
+// SessionStatus 输出会话计时状态，未配置的限制剩余时间为Unlimited
+type SessionStatus struct {
+	Continuous          time.Duration // 本次连续输出时长
+	ContinuousRemaining time.Duration // 距离连续输出上限的剩余时间
+	DailyUsed           time.Duration // 今日累计输出时长
+	DailyRemaining      time.Duration // 距离每日累计上限的剩余时间
+	CooldownRemaining   time.Duration // 冷却剩余时间，0表示未在冷却
+	AutoOffA            time.Duration // A通道距离自动关闭的剩余时间，0表示未设置
+	AutoOffB            time.Duration // B通道距离自动关闭的剩余时间，0表示未设置
+}
+
+// sessionState 输出会话计时，由控制器写锁保护
+type sessionState struct {
+	lastCheck     time.Time     // 上次计时的时间
+	start         time.Time     // 本次连续输出开始时间，零值表示未在输出
+	lastOutput    time.Time     // 最近一次有输出的时间
+	dailyUsed     time.Duration // 今日累计输出时长
+	day           string        // dailyUsed所属日期
+	cooldownUntil time.Time     // 冷却结束时间
+	autoOffA      time.Time     // A通道自动关闭时间
+	autoOffB      time.Time     // B通道自动关闭时间
+}
+
+// SetAutoOff 设置通道在after之后自动渐变归零，after为0时取消
+func (c *Controller) SetAutoOff(channel string, after time.Duration) error {
+	if after < 0 {
+		return fmt.Errorf("自动关闭时间不能为负数: %v", after)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var deadline time.Time
+	if after > 0 {
+		deadline = time.Now().Add(after)
+	}
+	switch channel {
+	case "A", "a":
+		c.session.autoOffA = deadline
+	case "B", "b":
+		c.session.autoOffB = deadline
+	default:
+		return fmt.Errorf("无效的通道: %s", channel)
+	}
+
+	if after > 0 {
+		log.Printf("%s通道将在%v后自动关闭", channel, after)
+	}
+	return nil
+}
+
+// SessionStatus 获取输出会话计时状态
+func (c *Controller) SessionStatus() SessionStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := time.Now()
+	cfg := c.config.Session
+	s := &c.session
+
+	status := SessionStatus{
+		DailyUsed:           s.dailyUsed,
+		ContinuousRemaining: Unlimited,
+		DailyRemaining:      Unlimited,
+		AutoOffA:            remainingUntil(now, s.autoOffA),
+		AutoOffB:            remainingUntil(now, s.autoOffB),
+		CooldownRemaining:   remainingUntil(now, s.cooldownUntil),
+	}
+	if !s.start.IsZero() {
+		status.Continuous = now.Sub(s.start)
+	}
+	if limit := minutes(cfg.MaxContinuous); limit > 0 {
+		status.ContinuousRemaining = clampRemaining(limit - status.Continuous)
+	}
+	if limit := minutes(cfg.MaxDaily); limit > 0 {
+		status.DailyRemaining = clampRemaining(limit - s.dailyUsed)
+	}
+	return status
+}
+
+// watchSession 定期累计输出时长并检查各项时间限制，直到控制器关闭
+func (c *Controller) watchSession() {
+	ticker := time.NewTicker(sessionCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stopCh:
+			return
+		case now := <-ticker.C:
+			c.checkSession(now)
+		}
+	}
+}
+
+// checkSession 累计输出时长，达到限制时渐变归零并进入冷却
+func (c *Controller) checkSession(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cfg := c.config.Session
+	s := &c.session
+	rampDown := time.Duration(cfg.RampDown) * time.Second
+
+	// 跨天时重置每日累计
+	today := now.Format("2006-01-02")
+	if s.day != today {
+		s.day = today
+		s.dailyUsed = 0
+	}
+
+	active := c.outputStrength("A") > 0 || c.outputStrength("B") > 0
+	if active {
+		// 只累计上次检查时就在输出的时间段
+		if !s.lastOutput.IsZero() && s.lastOutput.Equal(s.lastCheck) {
+			s.dailyUsed += now.Sub(s.lastCheck)
+		}
+		if s.start.IsZero() {
+			s.start = now
+		}
+		s.lastOutput = now
+	} else if !s.start.IsZero() && now.Sub(s.lastOutput) >= minutes(cfg.Cooldown) {
+		// 停止输出满一个冷却期才算结束本次连续输出，避免短暂归零绕过限制
+		s.start = time.Time{}
+	}
+	s.lastCheck = now
+
+	// 自动关闭计时
+	for _, channel := range []string{"A", "B"} {
+		deadline := &s.autoOffA
+		if channel == "B" {
+			deadline = &s.autoOffB
+		}
+		if deadline.IsZero() || now.Before(*deadline) {
+			continue
+		}
+		*deadline = time.Time{}
+		c.rampChannelToZero(channel, rampDown)
+		c.emitEvent(EventAutoOff, "%s通道自动关闭时间已到，在%v内归零", channel, rampDown)
+	}
+
+	if !active || now.Before(s.cooldownUntil) {
+		return
+	}
+
+	if limit := minutes(cfg.MaxContinuous); limit > 0 && now.Sub(s.start) >= limit {
+		s.cooldownUntil = now.Add(minutes(cfg.Cooldown))
+		s.start = time.Time{}
+		c.rampAllToZero(rampDown)
+		c.emitEvent(EventSessionLimit, "连续输出已达%v上限，归零并冷却%v", limit, minutes(cfg.Cooldown))
+		return
+	}
+
+	if limit := minutes(cfg.MaxDaily); limit > 0 && s.dailyUsed >= limit {
+		// 每日上限冷却到次日零点
+		year, month, day := now.Date()
+		s.cooldownUntil = time.Date(year, month, day+1, 0, 0, 0, 0, now.Location())
+		s.start = time.Time{}
+		c.rampAllToZero(rampDown)
+		c.emitEvent(EventSessionLimit, "今日累计输出已达%v上限，归零至次日", limit)
+	}
+}
+
+// rampChannelToZero 将单个通道渐变到0，调用方需持有写锁
+func (c *Controller) rampChannelToZero(channel string, duration time.Duration) {
+	c.cancelFires(channel)
+	current := c.currentStrength(channel)
+	if current == 0 {
+		c.cancelRamp(channel)
+		return
+	}
+	if duration <= 0 {
+		*c.rampSlot(channel) = nil
+		c.setCurrentStrength(channel, 0)
+		c.markPending(channel)
+		return
+	}
+	*c.rampSlot(channel) = &ramp{
+		from:     current,
+		to:       0,
+		start:    time.Now(),
+		duration: duration,
+		curve:    RampLinear,
+	}
+}
+
+// minutes 将配置的分钟数转换为时长
+func minutes(n int) time.Duration {
+	return time.Duration(n) * time.Minute
+}
+
+// remainingUntil 距离deadline的剩余时间，deadline为零值或已过返回0
+func remainingUntil(now, deadline time.Time) time.Duration {
+	if deadline.IsZero() || !now.Before(deadline) {
+		return 0
+	}
+	return deadline.Sub(now)
+}
+
+// clampRemaining 剩余时间不小于0
+func clampRemaining(d time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+	return d
+}
@@ -0,0 +1,158 @@
+package coyote
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"mygodblab/internal/config"
+)
+
+// ClientConsole 本地控制台的客户端标识
+const ClientConsole = "console"
+
+// commandWindow 统计客户端指令频率的时间窗口
+const commandWindow = time.Second
+
+// StrengthResult 强度指令的实际执行结果
+type StrengthResult struct {
+	Channel   string        // 通道
+	Requested int           // 请求的强度
+	Applied   int           // 实际设置（或渐变目标）的强度
+	Duration  time.Duration // 渐变用时，直接设置时为0
+	Notes     []string      // 控制器对请求所做的调整说明
+}
+
+// Adjusted 请求是否被调整过
+func (r StrengthResult) Adjusted() bool {
+	return len(r.Notes) > 0
+}
+
+// String 描述实际执行的结果
+func (r StrengthResult) String() string {
+	var sb strings.Builder
+	if r.Duration > 0 {
+		fmt.Fprintf(&sb, "%s通道强度将在%.1f秒内渐变到%d", r.Channel, r.Duration.Seconds(), r.Applied)
+	} else {
+		fmt.Fprintf(&sb, "%s通道强度已设置为%d", r.Channel, r.Applied)
+	}
+	if r.Adjusted() {
+		fmt.Fprintf(&sb, "（请求%d，%s）", r.Requested, strings.Join(r.Notes, "；"))
+	}
+	return sb.String()
+}
+
+// note 记录一条调整说明
+func (r *StrengthResult) note(format string, args ...interface{}) {
+	r.Notes = append(r.Notes, fmt.Sprintf(format, args...))
+}
+
+// slewBucket 单个通道的强度提升配额（令牌桶），容量和补充速率都是每秒最大提升量
+type slewBucket struct {
+	tokens float64   // 当前可提升的强度
+	last   time.Time // 上次补充配额的时间，渐变期间可能位于未来
+}
+
+// slewSettings 返回通道的速率限制配置
+func (c *Controller) slewSettings(channel string) config.SlewConfig {
+	if channel == "B" || channel == "b" {
+		return c.config.Channels.BChannel.Slew
+	}
+	return c.config.Channels.AChannel.Slew
+}
+
+// bucket 返回通道的配额桶，调用方需持有锁
+func (c *Controller) bucket(channel string) *slewBucket {
+	if channel == "B" || channel == "b" {
+		return &c.slewB
+	}
+	return &c.slewA
+}
+
+// checkCommandRate 限制每个客户端每秒提升强度的指令数，调用方需持有写锁
+// 只统计从current提升到target的指令，降低强度总是允许，也不占用次数
+func (c *Controller) checkCommandRate(client, channel string, current, target int) error {
+	limit := c.slewSettings(channel).MaxCommandsPerSecond
+	if limit <= 0 || target <= current {
+		return nil
+	}
+	if client == "" {
+		client = ClientConsole
+	}
+
+	now := time.Now()
+	key := client + "/" + strings.ToUpper(channel)
+	recent := c.commandTimes[key][:0]
+	for _, t := range c.commandTimes[key] {
+		if now.Sub(t) < commandWindow {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) >= limit {
+		c.commandTimes[key] = recent
+		return fmt.Errorf("%s 对%s通道的强度指令过于频繁：每秒最多%d次", client, channel, limit)
+	}
+	c.commandTimes[key] = append(recent, now)
+	return nil
+}
+
+// limitIncrease 按每秒最大提升量限制从current提升到target，返回允许的目标强度，调用方需持有写锁
+// clamp模式下按配额执行并在结果中说明；reject模式下超出配额直接拒绝
+func (c *Controller) limitIncrease(channel string, current, target int, result *StrengthResult) (int, error) {
+	settings := c.slewSettings(channel)
+	if settings.MaxDeltaPerSecond <= 0 || target <= current {
+		return target, nil
+	}
+
+	rate := float64(settings.MaxDeltaPerSecond)
+	b := c.bucket(channel)
+	now := time.Now()
+	if b.last.IsZero() {
+		b.tokens = rate
+	} else if now.After(b.last) {
+		b.tokens += now.Sub(b.last).Seconds() * rate
+		if b.tokens > rate {
+			b.tokens = rate
+		}
+	}
+	if now.After(b.last) {
+		b.last = now
+	}
+
+	allowed := int(b.tokens)
+	delta := target - current
+	if delta > allowed {
+		if settings.Mode == "reject" {
+			return current, fmt.Errorf("%s通道强度提升过快：请求+%d，当前最多允许+%d（每秒最多+%d）",
+				channel, delta, allowed, settings.MaxDeltaPerSecond)
+		}
+		result.note("提升速率受限，每秒最多+%d，本次只提升%d", settings.MaxDeltaPerSecond, allowed)
+		delta = allowed
+	}
+	b.tokens -= float64(delta)
+	return current + delta, nil
+}
+
+// limitRampRate 按每秒最大提升量限制渐变速度，必要时延长渐变时间，调用方需持有写锁
+// 向上渐变会占用渐变期间的全部配额
+func (c *Controller) limitRampRate(channel string, from, to int, duration time.Duration, result *StrengthResult) (time.Duration, error) {
+	settings := c.slewSettings(channel)
+	if settings.MaxDeltaPerSecond <= 0 || to <= from {
+		return duration, nil
+	}
+
+	minDuration := time.Duration(to-from) * time.Second / time.Duration(settings.MaxDeltaPerSecond)
+	if duration < minDuration {
+		if settings.Mode == "reject" {
+			return 0, fmt.Errorf("%s通道渐变过快：%d -> %d 至少需要%.1f秒（每秒最多+%d）",
+				channel, from, to, minDuration.Seconds(), settings.MaxDeltaPerSecond)
+		}
+		result.note("渐变速率受限，每秒最多+%d，渐变时间延长到%.1f秒", settings.MaxDeltaPerSecond, minDuration.Seconds())
+		duration = minDuration
+	}
+
+	b := c.bucket(channel)
+	b.tokens = 0
+	b.last = time.Now().Add(duration)
+	return duration, nil
+}
@@ -0,0 +1,180 @@
+package coyote
+
+import (
+	"testing"
+	"time"
+
+	"mygodblab/internal/config"
+	"mygodblab/internal/policy"
+)
+
+// slewController 只配置了A通道速率限制的控制器，足以测试配额计算
+func slewController(maxDelta, maxCommands int, mode string) *Controller {
+	cfg := config.DefaultConfig()
+	cfg.Channels.AChannel.Slew = config.SlewConfig{
+		MaxDeltaPerSecond:    maxDelta,
+		MaxCommandsPerSecond: maxCommands,
+		Mode:                 mode,
+	}
+	return &Controller{config: cfg, commandTimes: make(map[string][]time.Time)}
+}
+
+func TestLimitIncrease(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxDelta  int
+		mode      string
+		steps     [][2]int // 每次的当前强度和目标强度
+		want      []int
+		wantErr   []bool
+		wantNotes []int
+	}{
+		{
+			name:      "不限制",
+			maxDelta:  0,
+			steps:     [][2]int{{0, 150}},
+			want:      []int{150},
+			wantErr:   []bool{false},
+			wantNotes: []int{0},
+		},
+		{
+			name:      "clamp按配额执行",
+			maxDelta:  20,
+			mode:      "clamp",
+			steps:     [][2]int{{0, 15}, {15, 40}, {20, 60}},
+			want:      []int{15, 20, 20},
+			wantErr:   []bool{false, false, false},
+			wantNotes: []int{0, 1, 1},
+		},
+		{
+			name:      "reject拒绝超出配额",
+			maxDelta:  20,
+			mode:      "reject",
+			steps:     [][2]int{{0, 30}, {0, 20}, {20, 21}},
+			want:      []int{0, 20, 20},
+			wantErr:   []bool{true, false, true},
+			wantNotes: []int{0, 0, 0},
+		},
+		{
+			name:      "降低强度不占配额",
+			maxDelta:  10,
+			mode:      "reject",
+			steps:     [][2]int{{0, 10}, {10, 0}, {100, 0}},
+			want:      []int{10, 0, 0},
+			wantErr:   []bool{false, false, false},
+			wantNotes: []int{0, 0, 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := slewController(tt.maxDelta, 0, tt.mode)
+			for i, step := range tt.steps {
+				var result StrengthResult
+				got, err := c.limitIncrease("A", step[0], step[1], &result)
+				if got != tt.want[i] || (err != nil) != tt.wantErr[i] || len(result.Notes) != tt.wantNotes[i] {
+					t.Errorf("第%d步 limitIncrease(%d, %d) = %d, %v, notes %v", i+1, step[0], step[1], got, err, result.Notes)
+				}
+			}
+		})
+	}
+}
+
+func TestLimitIncreaseRefill(t *testing.T) {
+	c := slewController(20, 0, "reject")
+	var result StrengthResult
+	if _, err := c.limitIncrease("A", 0, 20, &result); err != nil {
+		t.Fatalf("首次提升 error = %v", err)
+	}
+	// 配额按时间补充：半秒后最多再提升10
+	c.slewA.last = time.Now().Add(-500 * time.Millisecond)
+	if _, err := c.limitIncrease("A", 20, 35, &result); err == nil {
+		t.Error("超出补充的配额 error = nil")
+	}
+	if got, err := c.limitIncrease("A", 20, 29, &result); err != nil || got != 29 {
+		t.Errorf("补充后提升 = %d, %v, want 29", got, err)
+	}
+}
+
+func TestLimitRampRate(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		from, to int
+		duration time.Duration
+		want     time.Duration
+		wantErr  bool
+	}{
+		{"速度允许", "clamp", 0, 20, 2 * time.Second, 2 * time.Second, false},
+		{"clamp延长渐变", "clamp", 0, 60, time.Second, 3 * time.Second, false},
+		{"reject拒绝", "reject", 0, 60, time.Second, 0, true},
+		{"向下渐变不限制", "reject", 100, 0, time.Second, time.Second, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := slewController(20, 0, tt.mode)
+			var result StrengthResult
+			got, err := c.limitRampRate("A", tt.from, tt.to, tt.duration, &result)
+			if got != tt.want || (err != nil) != tt.wantErr {
+				t.Errorf("limitRampRate() = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLimitRampRateUsesQuota(t *testing.T) {
+	c := slewController(20, 0, "reject")
+	var result StrengthResult
+	if _, err := c.limitRampRate("A", 0, 40, 2*time.Second, &result); err != nil {
+		t.Fatalf("limitRampRate() error = %v", err)
+	}
+	// 向上渐变期间的配额已被占用
+	if _, err := c.limitIncrease("A", 40, 41, &result); err == nil {
+		t.Error("渐变期间提升强度 error = nil")
+	}
+}
+
+func TestCheckCommandRate(t *testing.T) {
+	c := slewController(0, 2, "clamp")
+	for i := 0; i < 2; i++ {
+		if err := c.checkCommandRate("mcp", "A", 0, 10); err != nil {
+			t.Fatalf("第%d次 error = %v", i+1, err)
+		}
+	}
+	if err := c.checkCommandRate("mcp", "a", 10, 20); err == nil {
+		t.Error("超过每秒指令数 error = nil")
+	}
+	// 不同客户端分别计数
+	if err := c.checkCommandRate("", "A", 0, 10); err != nil {
+		t.Errorf("控制台 error = %v", err)
+	}
+	// 窗口过去后恢复
+	c.commandTimes["mcp/A"] = []time.Time{time.Now().Add(-2 * commandWindow), time.Now().Add(-2 * commandWindow)}
+	if err := c.checkCommandRate("mcp", "A", 0, 10); err != nil {
+		t.Errorf("窗口过去后 error = %v", err)
+	}
+}
+
+func TestCommandRateAllowsReduction(t *testing.T) {
+	c := slewController(0, 1, "clamp")
+	c.channelState = &ChannelState{AStrength: 50, ALimit: 200, AEnabled: true}
+	c.batteryCap = noStrengthCap
+	c.policy, _ = policy.NewEngine(nil)
+
+	if _, err := c.applyStrength(policy.ActionSetStrength, Caller{Client: "mcp"}, "A", 60); err != nil {
+		t.Fatalf("提升 error = %v", err)
+	}
+	if _, err := c.applyStrength(policy.ActionSetStrength, Caller{Client: "mcp"}, "A", 70); err == nil {
+		t.Fatal("超过每秒指令数的提升 error = nil")
+	}
+
+	// 配额用完后降低强度仍然允许，且不占用次数
+	for _, target := range []int{40, 20, 0} {
+		result, err := c.applyStrength(policy.ActionSetStrength, Caller{Client: "mcp"}, "A", target)
+		if err != nil || result.Applied != target {
+			t.Errorf("配额用完后降低到%d = %+v, %v", target, result, err)
+		}
+	}
+	if n := len(c.commandTimes["mcp/A"]); n != 1 {
+		t.Errorf("记录了%d次指令, want 1", n)
+	}
+}
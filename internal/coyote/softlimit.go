@@ -0,0 +1,90 @@
+package coyote
+
+import (
+	"fmt"
+	"log"
+
+	"mygodblab/internal/policy"
+	"mygodblab/internal/protocol"
+)
+
+// buildBFCommand 根据当前上限和平衡参数构建BF指令，调用方需持有锁
+// 急停锁存期间软上限始终为0
+func (c *Controller) buildBFCommand() *protocol.BFCommand {
+	cmd := &protocol.BFCommand{
+		ALimit:            protocol.ValidateStrength(c.channelState.ALimit),
+		BLimit:            protocol.ValidateStrength(c.channelState.BLimit),
+		AFrequencyBalance: validateBalance(c.channelState.AFrequencyBalance),
+		BFrequencyBalance: validateBalance(c.channelState.BFrequencyBalance),
+		AIntensityBalance: validateBalance(c.channelState.AIntensityBalance),
+		BIntensityBalance: validateBalance(c.channelState.BIntensityBalance),
+	}
+	if c.stopped.Load() {
+		cmd.ALimit, cmd.BLimit = 0, 0
+	}
+	return cmd
+}
+
+// syncSoftLimits 把当前上限和平衡参数通过BF指令写入设备，未连接时在下次连接后写入
+func (c *Controller) syncSoftLimits() error {
+	if !c.transport.IsConnected() {
+		return nil
+	}
+
+	c.mu.RLock()
+	cmd := c.buildBFCommand()
+	c.mu.RUnlock()
+
+	log.Printf("写入设备软上限: A=%d B=%d 频率平衡 A=%d B=%d 强度平衡 A=%d B=%d",
+		cmd.ALimit, cmd.BLimit, cmd.AFrequencyBalance, cmd.BFrequencyBalance,
+		cmd.AIntensityBalance, cmd.BIntensityBalance)
+	if err := c.sendCommand(cmd); err != nil {
+		return fmt.Errorf("写入设备软上限失败: %w", err)
+	}
+	return nil
+}
+
+// SetBalance 设置通道波形频率平衡和强度平衡参数(0-255)，之后按策略复核当前强度
+func (c *Controller) SetBalance(channel string, frequencyBalance, intensityBalance int) error {
+	if frequencyBalance < 0 || frequencyBalance > 255 {
+		return fmt.Errorf("频率平衡参数必须在0-255之间: %d", frequencyBalance)
+	}
+	if intensityBalance < 0 || intensityBalance > 255 {
+		return fmt.Errorf("强度平衡参数必须在0-255之间: %d", intensityBalance)
+	}
+
+	channel, err := normalizeChannel(channel)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	switch channel {
+	case "A":
+		c.channelState.AFrequencyBalance = frequencyBalance
+		c.channelState.AIntensityBalance = intensityBalance
+	case "B":
+		c.channelState.BFrequencyBalance = frequencyBalance
+		c.channelState.BIntensityBalance = intensityBalance
+	}
+	err = c.reviewStrength(policy.ActionSetBalance, channel, "")
+	c.stateChanged()
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("%s通道平衡参数设置为: 频率%d 强度%d", channel, frequencyBalance, intensityBalance)
+	return c.syncSoftLimits()
+}
+
+// validateBalance 将平衡参数限制在0-255
+func validateBalance(value int) byte {
+	if value < 0 {
+		return 0
+	}
+	if value > 255 {
+		return 255
+	}
+	return byte(value)
+}
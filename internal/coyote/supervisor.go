@@ -0,0 +1,233 @@
+package coyote
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"mygodblab/internal/transport"
+)
+
+// ConnectionState 设备连接状态
+type ConnectionState string
+
+const (
+	StateDisconnected ConnectionState = "disconnected" // 未连接
+	StateScanning     ConnectionState = "scanning"     // 首次扫描连接中
+	StateConnected    ConnectionState = "connected"    // 已连接
+	StateReconnecting ConnectionState = "reconnecting" // 链路丢失，正在重连
+)
+
+// maxWriteFailures 连续写入失败达到该次数即判定链路丢失
+const maxWriteFailures = 3
+
+// linkCheckInterval 检查链路状态的间隔
+const linkCheckInterval = time.Second
+
+// ConnectionStatus 连接状态信息
+type ConnectionStatus struct {
+	State      ConnectionState // 当前连接状态
+	Reconnects int             // 成功重连次数
+	LastError  string          // 最近一次连接失败或断线原因
+}
+
+// Start 启动连接监管，在后台扫描连接设备并在断线后自动重连
+// 每次扫描的超时时间取自配置 bluetooth.scan_timeout
+func (c *Controller) Start() {
+	timeout := time.Duration(c.config.Bluetooth.ScanTimeout) * time.Second
+	go c.supervise(timeout)
+}
+
+// ConnectionStatus 获取连接状态
+func (c *Controller) ConnectionStatus() ConnectionStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return ConnectionStatus{
+		State:      c.connState,
+		Reconnects: c.reconnects,
+		LastError:  c.lastConnErr,
+	}
+}
+
+// supervise 连接监管循环：连接 -> 等待断线 -> 指数退避重连
+func (c *Controller) supervise(timeout time.Duration) {
+	reconnect := c.config.Bluetooth.Reconnect
+	initialBackoff := time.Duration(reconnect.InitialBackoff) * time.Second
+	if initialBackoff <= 0 {
+		initialBackoff = time.Second
+	}
+	maxBackoff := time.Duration(reconnect.MaxBackoff) * time.Second
+	if maxBackoff < initialBackoff {
+		maxBackoff = initialBackoff
+	}
+
+	backoff := initialBackoff
+	everConnected := false
+
+	for {
+		if everConnected {
+			c.setConnState(StateReconnecting, "")
+		} else {
+			c.setConnState(StateScanning, "")
+		}
+
+		err := c.transport.ScanAndConnect(timeout, c.config.Bluetooth.DeviceNames)
+		if err != nil {
+			log.Printf("连接设备失败: %v", err)
+			if !reconnect.Enabled {
+				c.setConnState(StateDisconnected, err.Error())
+				return
+			}
+			c.recordConnError(err.Error())
+
+			log.Printf("%v 后重试连接", backoff)
+			select {
+			case <-c.stopCh:
+				return
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+			if backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+			continue
+		}
+
+		backoff = initialBackoff
+		// 状态同步和软上限写入完成前仍处于扫描/重连状态，播放循环不会发帧
+		c.resync(everConnected)
+		// 设备不保存BF参数，每次连接后重新写入软上限和平衡参数
+		if err := c.syncSoftLimits(); err != nil {
+			log.Printf("%v", err)
+		}
+		everConnected = true
+		c.setConnState(StateConnected, "")
+		log.Println("设备连接成功！")
+
+		// 等待链路丢失
+		reason := c.waitForLinkLoss()
+		if reason == "" {
+			return // 控制器已关闭
+		}
+
+		log.Printf("设备链路丢失: %s", reason)
+		c.transport.Disconnect()
+		c.recordConnError(reason)
+
+		if !reconnect.Enabled {
+			c.setConnState(StateDisconnected, "")
+			return
+		}
+	}
+}
+
+// waitForLinkLoss 阻塞直到检测到链路丢失，返回原因；控制器关闭时返回空字符串
+func (c *Controller) waitForLinkLoss() string {
+	notifyTimeout := time.Duration(c.config.Bluetooth.Reconnect.NotifyTimeout) * time.Second
+
+	ticker := time.NewTicker(linkCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stopCh:
+			return ""
+		case reason := <-c.lostCh:
+			return reason
+		case <-ticker.C:
+			if !c.transport.IsConnected() {
+				return "适配器报告连接已断开"
+			}
+
+			c.mu.RLock()
+			since := c.awaitingNotifySince
+			c.mu.RUnlock()
+			if notifyTimeout > 0 && !since.IsZero() && time.Since(since) > notifyTimeout {
+				return "设备长时间无回应"
+			}
+		}
+	}
+}
+
+// reportLinkLoss 通知监管循环链路已丢失（不阻塞）
+func (c *Controller) reportLinkLoss(reason string) {
+	select {
+	case c.lostCh <- reason:
+	default:
+	}
+}
+
+// recordWriteResult 统计写入结果，连续失败过多时判定链路丢失
+// 输出守卫拒绝的帧没有到达设备，不计入链路状态
+func (c *Controller) recordWriteResult(err error) {
+	if errors.Is(err, transport.ErrFrameRejected) {
+		return
+	}
+	c.mu.Lock()
+	if err == nil {
+		c.writeFailures = 0
+		c.mu.Unlock()
+		return
+	}
+	c.writeFailures++
+	failures := c.writeFailures
+	c.mu.Unlock()
+
+	if failures >= maxWriteFailures {
+		c.reportLinkLoss("连续写入失败: " + err.Error())
+	}
+}
+
+// resync 连接建立后重新同步状态：从0强度（或断线前强度）开始，重新播放当前波形
+func (c *Controller) resync(reconnected bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if reconnected {
+		c.reconnects++
+	}
+	if !c.config.Bluetooth.Reconnect.RestoreStrength {
+		c.channelState.AStrength = 0
+		c.channelState.BStrength = 0
+	}
+	c.frameIndexA, c.frameIndexB = 0, 0
+	c.pendingA, c.pendingB = true, true
+	c.rampA, c.rampB = nil, nil // 断线前的渐变不再继续
+	c.firesA, c.firesB = nil, nil
+	c.inflight = nil // 断线前未确认的变更不再等待
+	// 新连接的设备从0开始，守卫不能再按断线前的强度校验相对变更
+	c.guard.SetStrength(0, 0)
+	c.writeFailures = 0
+	c.awaitingNotifySince = time.Time{}
+	select {
+	case <-c.lostCh: // 丢弃上一次连接遗留的断线通知
+	default:
+	}
+
+	log.Printf("同步设备状态: A=%d/%d 波形%s B=%d/%d 波形%s",
+		c.channelState.AStrength, c.channelState.ALimit, c.channelState.APulse,
+		c.channelState.BStrength, c.channelState.BLimit, c.channelState.BPulse)
+}
+
+// setConnState 更新连接状态，reason非空时记录为最近错误
+func (c *Controller) setConnState(state ConnectionState, reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.connState != state {
+		log.Printf("连接状态: %s -> %s", c.connState, state)
+		c.stateChanged()
+	}
+	c.connState = state
+	if reason != "" {
+		c.lastConnErr = reason
+	}
+}
+
+// recordConnError 记录最近一次连接失败原因
+func (c *Controller) recordConnError(reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastConnErr = reason
+}
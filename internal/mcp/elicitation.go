@@ -0,0 +1,206 @@
+package mcp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"mygodblab/internal/coyote"
+)
+
+// toolCall 一次工具调用的上下文
+// 需要用户确认时，先通过out发送确认请求，最后发送工具调用结果（HTTP下POST的响应升级为SSE流）
+type toolCall struct {
+	out     replier
+	ctx     context.Context
+	id      interface{} // 工具调用请求的ID
+	client  string      // 客户端标识
+	session *session    // 请求所属的会话
+}
+
+// initSession 记录客户端在initialize中声明的能力，重新初始化时清空会话记录
+func (h *Handler) initSession(s *session, protocolVersion string, capabilities map[string]interface{}) {
+	_, elicitation := capabilities["elicitation"]
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s.protocolVersion = protocolVersion
+	s.elicitation = elicitation
+	s.usedPulses = make(map[string]bool)
+}
+
+// confirm 通过 elicitation/create 请求用户确认，用户接受时返回nil
+// 客户端不支持确认、用户拒绝或超时都返回错误，调用方不得执行操作
+func (h *Handler) confirm(call *toolCall, message string) error {
+	h.mu.Lock()
+	supported := call.session.elicitation
+	h.mu.Unlock()
+	if !supported {
+		return fmt.Errorf("该操作需要用户确认，但客户端不支持 elicitation（需在 initialize 中声明 elicitation 能力）: %s", message)
+	}
+	id, answer := h.newPendingRequest(call.session)
+	defer h.dropPendingRequest(call.session, id)
+
+	request := MCPMessage{
+		JSONRPC: "2.0",
+		ID:      id,
+		Method:  "elicitation/create",
+		Params: map[string]interface{}{
+			"message": message,
+			"requestedSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"confirm": map[string]interface{}{
+						"type":        "boolean",
+						"title":       "允许执行",
+						"description": "选择是否允许该操作",
+					},
+				},
+				"required": []string{"confirm"},
+			},
+		},
+	}
+	log.Printf("[确认] 向客户端%s请求确认: %s", call.client, message)
+	if err := call.out.request(request); err != nil {
+		return fmt.Errorf("该操作需要用户确认，但%v", err)
+	}
+
+	timeout := time.Duration(h.config.ElicitationTimeout) * time.Second
+	select {
+	case response := <-answer:
+		err := elicitationAnswer(response)
+		if err != nil {
+			log.Printf("[确认] 客户端%s未确认: %v", call.client, err)
+			return err
+		}
+		log.Printf("[确认] 客户端%s已确认", call.client)
+		return nil
+	case <-time.After(timeout):
+		log.Printf("[确认] 客户端%s在%v内未回应，视为拒绝", call.client, timeout)
+		return fmt.Errorf("用户未在%v内确认，操作已取消", timeout)
+	case <-call.ctx.Done():
+		return fmt.Errorf("连接已断开，操作已取消")
+	}
+}
+
+// elicitationAnswer 解析用户对确认请求的回应，只有接受且勾选允许才返回nil
+func elicitationAnswer(response MCPMessage) error {
+	if response.Error != nil {
+		return fmt.Errorf("确认请求失败: %s", response.Error.Message)
+	}
+	result, _ := response.Result.(map[string]interface{})
+	action, _ := result["action"].(string)
+	switch action {
+	case "accept":
+		content, _ := result["content"].(map[string]interface{})
+		if allowed, _ := content["confirm"].(bool); allowed {
+			return nil
+		}
+		return errors.New("用户未允许该操作")
+	case "decline":
+		return errors.New("用户拒绝了该操作")
+	case "cancel":
+		return errors.New("用户取消了确认")
+	default:
+		return fmt.Errorf("无法识别的确认结果: %q", action)
+	}
+}
+
+// pendingKey 等待回应的服务器请求的标识
+// 请求只发给了一个会话，只接受该会话的回应
+type pendingKey struct {
+	session string // 收到请求的会话ID
+	id      string // 服务器请求ID
+}
+
+// newPendingRequest 分配随机的服务器请求ID并登记等待s回应的通道
+// ID不可预测，其他会话无法猜出并代为回应
+func (h *Handler) newPendingRequest(s *session) (string, chan MCPMessage) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		// crypto/rand 在支持的平台上不会失败
+		panic(fmt.Sprintf("生成请求ID失败: %v", err))
+	}
+	id := "elicit-" + hex.EncodeToString(buf)
+	answer := make(chan MCPMessage, 1)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.pending[pendingKey{s.id, id}] = answer
+	return id, answer
+}
+
+// dropPendingRequest 不再等待该请求的回应
+func (h *Handler) dropPendingRequest(s *session, id string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.pending, pendingKey{s.id, id})
+}
+
+// handleClientResponse 处理会话s对服务器请求的回应（如确认结果）
+// 回应只能来自收到请求的会话，其他会话发来的同ID回应被丢弃
+func (h *Handler) handleClientResponse(s *session, msg MCPMessage) {
+	key := pendingKey{s.id, fmt.Sprint(msg.ID)}
+
+	h.mu.Lock()
+	answer, ok := h.pending[key]
+	delete(h.pending, key)
+	h.mu.Unlock()
+
+	if ok {
+		answer <- msg
+	} else {
+		log.Printf("[确认] 会话%s发来未知、已超时或不属于该会话的请求回应，已丢弃: %s", s.id, key.id)
+	}
+}
+
+// confirmStrength 执行强度操作，超过舒适阈值时请求用户确认后以已确认身份重试
+func (h *Handler) confirmStrength(call *toolCall, describe string, apply func(caller coyote.Caller) error) error {
+	caller := coyote.Caller{Client: call.client}
+	err := apply(caller)
+
+	var required *coyote.ConfirmationRequired
+	if !errors.As(err, &required) {
+		return err
+	}
+	if err := h.confirm(call, fmt.Sprintf("%s：%s。是否允许？", describe, required.Reason)); err != nil {
+		return err
+	}
+
+	caller.Confirmed = true
+	return apply(caller)
+}
+
+// confirmPulse 本次会话首次使用的波形需要用户确认；通道上正在播放的波形视为已使用
+// 不存在的波形不请求确认，由设置波形时报错
+func (h *Handler) confirmPulse(call *toolCall, pulseID string) error {
+	h.mu.Lock()
+	used := call.session.usedPulses[pulseID]
+	h.mu.Unlock()
+	if used {
+		return nil
+	}
+
+	status := h.service.GetStatus()
+	if status.AChannel.Pulse == pulseID || status.BChannel.Pulse == pulseID {
+		return nil
+	}
+
+	for _, pulse := range h.service.ListPulses() {
+		if pulse.ID == pulseID {
+			return h.confirm(call, fmt.Sprintf("请求切换到本次会话未使用过的波形 %s(%s)。是否允许？", pulse.Name, pulse.ID))
+		}
+	}
+	return nil
+}
+
+// markPulseUsed 记录本次会话已使用的波形
+func (h *Handler) markPulseUsed(s *session, pulseID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s.usedPulses[pulseID] = true
+}
@@ -1,19 +1,60 @@
 package mcp
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"log"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"mygodblab/internal/config"
+	"mygodblab/internal/coyote"
 )
 
+// supportedProtocolVersions 支持的MCP协议版本，第一个为首选版本
+var supportedProtocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+// streamKeepAlive GET流发送保活注释的间隔，避免代理断开空闲连接
+const streamKeepAlive = 25 * time.Second
+
+// supportedVersion 判断协议版本是否受支持
+func supportedVersion(version string) bool {
+	for _, supported := range supportedProtocolVersions {
+		if version == supported {
+			return true
+		}
+	}
+	return false
+}
+
 // Handler MCP请求处理器
 type Handler struct {
 	service *Service
+	config  config.MCPConfig
+	prompts []*promptTemplate // 从提示模板文件加载，启动后不再变化
+
+	mu       sync.Mutex
+	sessions map[string]*session            // 进行中的会话
+	pending  map[pendingKey]chan MCPMessage // 等待客户端回应的服务器请求
 }
 
-// NewHandler 创建新的Handler实例
-func NewHandler(service *Service) *Handler {
-	return &Handler{service: service}
+// NewHandler 创建新的Handler实例，并开始监视订阅的资源
+func NewHandler(service *Service, cfg config.MCPConfig) *Handler {
+	h := &Handler{
+		service:  service,
+		config:   cfg,
+		sessions: make(map[string]*session),
+		pending:  make(map[pendingKey]chan MCPMessage),
+	}
+	h.prompts = loadPrompts(cfg.PromptsPath)
+	go h.watchResources()
+	return h
 }
 
 // MCPMessage MCP协议消息
@@ -40,87 +81,215 @@ type Tool struct {
 	InputSchema interface{} `json:"inputSchema"`
 }
 
-// HandleRequest 处理MCP请求
+// HandleRequest 处理MCP请求（Streamable HTTP）
+// POST发送JSON-RPC消息，GET打开接收服务器消息的SSE流，DELETE结束会话
 func (h *Handler) HandleRequest(w http.ResponseWriter, r *http.Request) {
-	// 设置SSE头
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	h.setCORSHeaders(w)
 
 	if r.Method == http.MethodOptions {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
 
-	if r.Method == http.MethodGet {
-		// 处理SSE连接
-		h.handleSSE(w, r)
+	// 防止DNS重绑定：只接受本机网页发起的跨域请求
+	if !LocalOrigin(r.Header.Get("Origin")) {
+		h.sendHTTPError(w, http.StatusForbidden, "Origin not allowed")
 		return
 	}
 
-	if r.Method == http.MethodPost {
-		// 处理JSON-RPC请求
+	switch r.Method {
+	case http.MethodPost:
 		h.handleJSONRPC(w, r)
+	case http.MethodGet:
+		h.handleStream(w, r)
+	case http.MethodDelete:
+		h.handleDelete(w, r)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handleJSONRPC 处理POST的JSON-RPC消息
+// initialize 创建新会话并在 Mcp-Session-Id 响应头中返回，之后的请求都必须带上该会话ID
+func (h *Handler) handleJSONRPC(w http.ResponseWriter, r *http.Request) {
+	var msg MCPMessage
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		h.sendJSONRPCError(w, nil, -32700, "Parse error")
+		return
+	}
+
+	var s *session
+	if msg.Method == "initialize" {
+		s = h.newSession(nil)
+		w.Header().Set("Mcp-Session-Id", s.id)
+		log.Printf("[会话] 客户端%s创建会话 %s", ClientID(r), s.id)
+	} else {
+		var ok bool
+		if s, ok = h.requestSession(w, r); !ok {
+			return
+		}
+	}
+
+	// 没有方法名的消息是客户端对服务器请求的回应，以202确认收到
+	if msg.Method == "" && msg.ID != nil {
+		h.handleClientResponse(s, msg)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	// 通知不需要回应
+	if msg.ID == nil {
+		w.WriteHeader(http.StatusAccepted)
 		return
 	}
 
-	w.WriteHeader(http.StatusMethodNotAllowed)
+	h.dispatch(r.Context(), msg, ClientID(r), s, &httpReplier{h: h, w: w, session: s})
 }
 
-// handleSSE 处理Server-Sent Events连接
-func (h *Handler) handleSSE(w http.ResponseWriter, r *http.Request) {
+// handleStream 打开GET流，发送会话中服务器主动发起的消息
+// 带 Last-Event-ID 时从该事件之后续传；同一会话新的GET流会取代旧的
+func (h *Handler) handleStream(w http.ResponseWriter, r *http.Request) {
+	if !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	s, ok := h.requestSession(w, r)
+	if !ok {
+		return
+	}
 	flusher, ok := w.(http.Flusher)
 	if !ok {
 		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
 		return
 	}
 
-	// 发送初始化消息
-	initMsg := MCPMessage{
-		JSONRPC: "2.0",
-		Method:  "notifications/initialized",
-		Params:  map[string]interface{}{"protocolVersion": "2024-11-05"},
-	}
+	lastEventID, _ := strconv.Atoi(r.Header.Get("Last-Event-ID"))
+	wake, replay, cursor := h.attachStream(s, lastEventID)
+	defer h.detachStream(s, wake)
 
-	h.sendSSEMessage(w, initMsg)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	for _, event := range replay {
+		h.sendSSEEvent(w, event)
+	}
 	flusher.Flush()
 
-	// 保持连接
-	select {
-	case <-r.Context().Done():
-		return
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		for _, event := range h.pendingEvents(s, cursor) {
+			h.sendSSEEvent(w, event)
+			cursor = event.id
+		}
+		flusher.Flush()
+
+		select {
+		case _, open := <-wake:
+			if !open {
+				// 被同一会话新的GET流取代
+				return
+			}
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case <-s.closed:
+			return
+		case <-r.Context().Done():
+			return
+		}
 	}
 }
 
-// handleJSONRPC 处理JSON-RPC请求
-func (h *Handler) handleJSONRPC(w http.ResponseWriter, r *http.Request) {
-	var msg MCPMessage
-	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
-		h.sendJSONRPCError(w, nil, -32700, "Parse error")
+// handleDelete 客户端结束会话
+func (h *Handler) handleDelete(w http.ResponseWriter, r *http.Request) {
+	id := r.Header.Get("Mcp-Session-Id")
+	if id == "" {
+		h.sendHTTPError(w, http.StatusBadRequest, "Missing Mcp-Session-Id header")
+		return
+	}
+	if !h.endSession(id) {
+		h.sendHTTPError(w, http.StatusNotFound, "Session not found")
 		return
 	}
+	log.Printf("[会话] 客户端%s结束会话 %s", ClientID(r), id)
+	w.WriteHeader(http.StatusOK)
+}
 
+// requestSession 校验请求的会话ID和协议版本，失败时已写入错误响应
+// 缺少会话ID返回400，会话不存在或已结束返回404（客户端应重新initialize）
+func (h *Handler) requestSession(w http.ResponseWriter, r *http.Request) (*session, bool) {
+	id := r.Header.Get("Mcp-Session-Id")
+	if id == "" {
+		h.sendHTTPError(w, http.StatusBadRequest, "Missing Mcp-Session-Id header")
+		return nil, false
+	}
+	s := h.lookupSession(id)
+	if s == nil {
+		h.sendHTTPError(w, http.StatusNotFound, "Session not found")
+		return nil, false
+	}
+
+	// 未带协议版本头的客户端按 2025-03-26 处理，带了则必须是initialize时协商的版本
+	if version := r.Header.Get("MCP-Protocol-Version"); version != "" {
+		h.mu.Lock()
+		negotiated := s.protocolVersion
+		h.mu.Unlock()
+		if !supportedVersion(version) || (negotiated != "" && version != negotiated) {
+			h.sendHTTPError(w, http.StatusBadRequest, fmt.Sprintf("Unsupported protocol version: %s", version))
+			return nil, false
+		}
+	}
+	return s, true
+}
+
+// dispatch 按方法名分发一条请求，HTTP和stdio共用，结果通过out发送
+func (h *Handler) dispatch(ctx context.Context, msg MCPMessage, client string, s *session, out replier) {
 	switch msg.Method {
 	case "initialize":
-		h.handleInitialize(w, msg)
+		h.handleInitialize(out, msg, s)
+	case "ping":
+		out.reply(MCPMessage{JSONRPC: "2.0", ID: msg.ID, Result: map[string]interface{}{}})
 	case "tools/list":
-		h.handleToolsList(w, msg)
+		h.handleToolsList(out, msg)
 	case "tools/call":
-		h.handleToolsCall(w, msg)
+		h.handleToolsCall(&toolCall{out: out, ctx: ctx, id: msg.ID, client: client, session: s}, msg)
+	case "resources/list":
+		h.handleResourcesList(out, msg)
+	case "resources/templates/list":
+		h.handleResourceTemplatesList(out, msg)
+	case "resources/read":
+		h.handleResourcesRead(out, msg)
+	case "resources/subscribe":
+		h.handleResourcesSubscribe(out, msg, s)
+	case "resources/unsubscribe":
+		h.handleResourcesUnsubscribe(out, msg, s)
+	case "prompts/list":
+		h.handlePromptsList(out, msg)
+	case "prompts/get":
+		h.handlePromptsGet(out, msg)
 	default:
-		h.sendJSONRPCError(w, msg.ID, -32601, "Method not found")
+		out.reply(errorResponse(msg.ID, -32601, "Method not found"))
 	}
 }
 
-// handleInitialize 处理初始化请求
-func (h *Handler) handleInitialize(w http.ResponseWriter, msg MCPMessage) {
+// handleInitialize 处理初始化请求，记录客户端能力并协商协议版本
+func (h *Handler) handleInitialize(out replier, msg MCPMessage, s *session) {
+	params, _ := msg.Params.(map[string]interface{})
+	capabilities, _ := params["capabilities"].(map[string]interface{})
+	requested, _ := params["protocolVersion"].(string)
+
+	version := supportedProtocolVersions[0]
+	if supportedVersion(requested) {
+		version = requested
+	}
+	h.initSession(s, version, capabilities)
+
 	result := map[string]interface{}{
-		"protocolVersion": "2024-11-05",
+		"protocolVersion": version,
 		"capabilities": map[string]interface{}{
-			"tools": map[string]interface{}{},
+			"tools":     map[string]interface{}{},
+			"resources": map[string]interface{}{"subscribe": true},
+			"prompts":   map[string]interface{}{},
 		},
 		"serverInfo": map[string]interface{}{
 			"name":    "DG-LAB MCP Server",
@@ -134,24 +303,127 @@ func (h *Handler) handleInitialize(w http.ResponseWriter, msg MCPMessage) {
 		Result:  result,
 	}
 
-	h.sendJSONRPCResponse(w, response)
+	out.reply(response)
 }
 
 // handleToolsList 处理工具列表请求
-func (h *Handler) handleToolsList(w http.ResponseWriter, msg MCPMessage) {
+func (h *Handler) handleToolsList(out replier, msg MCPMessage) {
 	tools := []Tool{
 		{
 			Name:        "set_strength",
-			Description: "设置通道强度",
+			Description: "设置通道强度，向上跳变较大时自动渐变（immediate为true时直接跳变）",
 			InputSchema: map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
-					"channel": map[string]interface{}{"type": "string", "enum": []string{"A", "B"}},
-					"strength": map[string]interface{}{"type": "integer", "minimum": 0, "maximum": 200},
+					"channel":        map[string]interface{}{"type": "string", "enum": []string{"A", "B"}},
+					"strength":       map[string]interface{}{"type": "integer", "minimum": 0, "maximum": 200},
+					"immediate":      map[string]interface{}{"type": "boolean"},
+					"auto_off_after": map[string]interface{}{"type": "number", "minimum": 0, "description": "该时间(秒)后自动渐变归零"},
 				},
 				"required": []string{"channel", "strength"},
 			},
 		},
+		{
+			Name:        "ramp_strength",
+			Description: "在指定时间内将通道强度平滑渐变到目标值，新的渐变或直接设置强度会取代正在进行的渐变",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"channel":        map[string]interface{}{"type": "string", "enum": []string{"A", "B"}},
+					"target":         map[string]interface{}{"type": "integer", "minimum": 0, "maximum": 200},
+					"duration":       map[string]interface{}{"type": "number", "minimum": 0, "description": "渐变时间(秒)"},
+					"curve":          map[string]interface{}{"type": "string", "enum": []string{"linear", "ease-in", "exponential"}},
+					"auto_off_after": map[string]interface{}{"type": "number", "minimum": 0, "description": "该时间(秒)后自动渐变归零"},
+				},
+				"required": []string{"channel", "target", "duration"},
+			},
+		},
+		{
+			Name:        "fire",
+			Description: "临时叠加：在duration秒内将通道强度增加delta并可临时换成指定波形，到期后恢复到届时的基础强度和波形；多个叠加可以重叠",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"channel":  map[string]interface{}{"type": "string", "enum": []string{"A", "B"}},
+					"delta":    map[string]interface{}{"type": "integer", "minimum": -200, "maximum": 200, "description": "强度增量"},
+					"pulse_id": map[string]interface{}{"type": "string", "description": "叠加期间播放的波形ID（可选）"},
+					"duration": map[string]interface{}{"type": "number", "exclusiveMinimum": 0, "maximum": 60, "description": "持续时间(秒)"},
+				},
+				"required": []string{"channel", "delta", "duration"},
+			},
+		},
+		{
+			Name:        "cancel_fire",
+			Description: "立即结束临时叠加，恢复基础强度和波形（默认两个通道）",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"channel": map[string]interface{}{"type": "string", "enum": []string{"A", "B"}},
+				},
+			},
+		},
+		{
+			Name:        "cancel_ramp",
+			Description: "取消正在进行的强度渐变，强度停留在当前值（默认两个通道）",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"channel": map[string]interface{}{"type": "string", "enum": []string{"A", "B"}},
+				},
+			},
+		},
+		{
+			Name:        "emergency_stop",
+			Description: "急停：立即将两个通道强度归零并锁定，之后必须调用 rearm 才能恢复输出",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"reason": map[string]interface{}{"type": "string"},
+				},
+			},
+		},
+		{
+			Name:        "rearm",
+			Description: "解除急停锁定，强度从0开始",
+			InputSchema: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+		},
+		{
+			Name:        "open_lease",
+			Description: "打开控制租约（死人开关）：必须在ttl秒内调用 renew_lease 续约，否则所有通道渐变归零",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"holder": map[string]interface{}{"type": "string", "description": "持有者名称"},
+					"ttl":    map[string]interface{}{"type": "number", "description": "续约窗口(秒)，默认使用配置值"},
+				},
+				"required": []string{"holder"},
+			},
+		},
+		{
+			Name:        "renew_lease",
+			Description: "续约控制租约",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"lease_id": map[string]interface{}{"type": "string"},
+				},
+				"required": []string{"lease_id"},
+			},
+		},
+		{
+			Name:        "release_lease",
+			Description: "释放控制租约，输出保持不变",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"lease_id": map[string]interface{}{"type": "string"},
+				},
+				"required": []string{"lease_id"},
+			},
+		},
 		{
 			Name:        "set_limit",
 			Description: "设置通道强度上限",
@@ -159,38 +431,105 @@ func (h *Handler) handleToolsList(w http.ResponseWriter, msg MCPMessage) {
 				"type": "object",
 				"properties": map[string]interface{}{
 					"channel": map[string]interface{}{"type": "string", "enum": []string{"A", "B"}},
-					"limit": map[string]interface{}{"type": "integer", "minimum": 0, "maximum": 200},
+					"limit":   map[string]interface{}{"type": "integer", "minimum": 0, "maximum": 200},
 				},
 				"required": []string{"channel", "limit"},
 			},
 		},
+		{
+			Name:        "set_balance",
+			Description: "设置通道波形平衡参数（写入设备BF指令）",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"channel":           map[string]interface{}{"type": "string", "enum": []string{"A", "B"}},
+					"frequency_balance": map[string]interface{}{"type": "integer", "minimum": 0, "maximum": 255},
+					"intensity_balance": map[string]interface{}{"type": "integer", "minimum": 0, "maximum": 255},
+				},
+				"required": []string{"channel"},
+			},
+		},
 		{
 			Name:        "set_pulse",
-			Description: "设置波形",
+			Description: "设置波形，可指定通道（默认两个通道）",
 			InputSchema: map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
 					"pulse_id": map[string]interface{}{"type": "string"},
+					"channel":  map[string]interface{}{"type": "string", "enum": []string{"A", "B"}},
 				},
 				"required": []string{"pulse_id"},
 			},
 		},
+		{
+			Name:        "set_channel_enabled",
+			Description: "启用或禁用通道，禁用的通道强度归零且不再输出",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"channel": map[string]interface{}{"type": "string", "enum": []string{"A", "B"}},
+					"enabled": map[string]interface{}{"type": "boolean"},
+				},
+				"required": []string{"channel", "enabled"},
+			},
+		},
 		{
 			Name:        "get_status",
 			Description: "获取设备状态",
 			InputSchema: map[string]interface{}{
-				"type": "object",
+				"type":       "object",
 				"properties": map[string]interface{}{},
 			},
 		},
 		{
 			Name:        "list_pulses",
 			Description: "获取可用波形列表",
+			InputSchema: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+		},
+		{
+			Name:        "save_scene",
+			Description: "将两个通道当前的启用状态、上限、强度和波形保存为场景，同名场景被覆盖",
 			InputSchema: map[string]interface{}{
 				"type": "object",
+				"properties": map[string]interface{}{
+					"name": map[string]interface{}{"type": "string", "description": "场景名称，不能包含空白字符"},
+				},
+				"required": []string{"name"},
+			},
+		},
+		{
+			Name:        "load_scene",
+			Description: "加载场景：设置通道启用状态、上限和波形，强度按自动渐变速率渐变到场景中的值，经过安全策略限制",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"name": map[string]interface{}{"type": "string", "description": "场景名称"},
+				},
+				"required": []string{"name"},
+			},
+		},
+		{
+			Name:        "list_scenes",
+			Description: "获取已保存的场景列表",
+			InputSchema: map[string]interface{}{
+				"type":       "object",
 				"properties": map[string]interface{}{},
 			},
 		},
+		{
+			Name:        "delete_scene",
+			Description: "删除已保存的场景",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"name": map[string]interface{}{"type": "string", "description": "场景名称"},
+				},
+				"required": []string{"name"},
+			},
+		},
 	}
 
 	result := map[string]interface{}{
@@ -203,20 +542,21 @@ func (h *Handler) handleToolsList(w http.ResponseWriter, msg MCPMessage) {
 		Result:  result,
 	}
 
-	h.sendJSONRPCResponse(w, response)
+	out.reply(response)
 }
 
 // handleToolsCall 处理工具调用请求
-func (h *Handler) handleToolsCall(w http.ResponseWriter, msg MCPMessage) {
+// call.client 为发起请求的客户端标识，用于按客户端限制指令频率和请求用户确认
+func (h *Handler) handleToolsCall(call *toolCall, msg MCPMessage) {
 	params, ok := msg.Params.(map[string]interface{})
 	if !ok {
-		h.sendJSONRPCError(w, msg.ID, -32602, "Invalid params")
+		h.replyError(call, -32602, "Invalid params")
 		return
 	}
 
 	toolName, ok := params["name"].(string)
 	if !ok {
-		h.sendJSONRPCError(w, msg.ID, -32602, "Missing tool name")
+		h.replyError(call, -32602, "Missing tool name")
 		return
 	}
 
@@ -230,25 +570,66 @@ func (h *Handler) handleToolsCall(w http.ResponseWriter, msg MCPMessage) {
 
 	switch toolName {
 	case "set_strength":
-		result, err = h.callSetStrength(arguments)
+		result, err = h.callSetStrength(call, arguments)
+	case "ramp_strength":
+		result, err = h.callRampStrength(call, arguments)
+	case "fire":
+		result, err = h.callFire(call, arguments)
+	case "cancel_fire":
+		result, err = h.callCancelFire(arguments)
+	case "cancel_ramp":
+		result, err = h.callCancelRamp(arguments)
+	case "emergency_stop":
+		result, err = h.callEmergencyStop(arguments)
+	case "rearm":
+		result, err = h.callRearm(call, arguments)
+	case "open_lease":
+		result, err = h.callOpenLease(arguments)
+	case "renew_lease":
+		result, err = h.callRenewLease(arguments)
+	case "release_lease":
+		result, err = h.callReleaseLease(arguments)
 	case "set_limit":
 		result, err = h.callSetLimit(arguments)
+	case "set_balance":
+		result, err = h.callSetBalance(arguments)
 	case "set_pulse":
-		result, err = h.callSetPulse(arguments)
+		result, err = h.callSetPulse(call, arguments)
+	case "set_channel_enabled":
+		result, err = h.callSetChannelEnabled(arguments)
 	case "get_status":
 		result, err = h.callGetStatus(arguments)
 	case "list_pulses":
 		result, err = h.callListPulses(arguments)
+	case "save_scene":
+		result, err = h.callSaveScene(arguments)
+	case "load_scene":
+		result, err = h.callLoadScene(call, arguments)
+	case "list_scenes":
+		result, err = h.callListScenes(arguments)
+	case "delete_scene":
+		result, err = h.callDeleteScene(arguments)
 	default:
-		h.sendJSONRPCError(w, msg.ID, -32601, "Unknown tool")
+		h.replyError(call, -32601, "Unknown tool")
 		return
 	}
 
 	if err != nil {
-		h.sendJSONRPCError(w, msg.ID, -32603, err.Error())
+		h.replyError(call, -32603, err.Error())
 		return
 	}
 
+	// 结构化结果以JSON文本返回，便于客户端解析（如租约ID）
+	text, ok := result.(string)
+	if !ok {
+		data, err := json.Marshal(result)
+		if err != nil {
+			h.replyError(call, -32603, err.Error())
+			return
+		}
+		text = string(data)
+	}
+
 	response := MCPMessage{
 		JSONRPC: "2.0",
 		ID:      msg.ID,
@@ -256,17 +637,17 @@ func (h *Handler) handleToolsCall(w http.ResponseWriter, msg MCPMessage) {
 			"content": []map[string]interface{}{
 				{
 					"type": "text",
-					"text": fmt.Sprintf("%v", result),
+					"text": text,
 				},
 			},
 		},
 	}
 
-	h.sendJSONRPCResponse(w, response)
+	h.reply(call, response)
 }
 
 // 工具调用实现
-func (h *Handler) callSetStrength(args map[string]interface{}) (interface{}, error) {
+func (h *Handler) callSetStrength(call *toolCall, args map[string]interface{}) (interface{}, error) {
 	channel, ok := args["channel"].(string)
 	if !ok {
 		return nil, fmt.Errorf("invalid channel")
@@ -276,12 +657,201 @@ func (h *Handler) callSetStrength(args map[string]interface{}) (interface{}, err
 		return nil, fmt.Errorf("invalid strength")
 	}
 
-	err := h.service.SetStrength(channel, int(strength))
+	// immediate 可选，为true时不自动渐变
+	immediate, _ := args["immediate"].(bool)
+
+	autoOff, err := secondsArg(args, "auto_off_after")
 	if err != nil {
 		return nil, err
 	}
 
-	return "强度设置成功", nil
+	var result coyote.StrengthResult
+	describe := fmt.Sprintf("请求将%s通道强度设置为%d", channel, int(strength))
+	err = h.confirmStrength(call, describe, func(caller coyote.Caller) error {
+		var err error
+		result, err = h.service.SetStrength(caller, channel, int(strength), immediate, autoOff)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result.String(), nil
+}
+
+func (h *Handler) callRampStrength(call *toolCall, args map[string]interface{}) (interface{}, error) {
+	channel, ok := args["channel"].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid channel")
+	}
+	target, ok := args["target"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("invalid target")
+	}
+	seconds, ok := args["duration"].(float64)
+	if !ok || seconds < 0 {
+		return nil, fmt.Errorf("invalid duration")
+	}
+	// curve 可选，默认线性
+	curve, _ := args["curve"].(string)
+
+	autoOff, err := secondsArg(args, "auto_off_after")
+	if err != nil {
+		return nil, err
+	}
+
+	duration := time.Duration(seconds * float64(time.Second))
+	var result coyote.StrengthResult
+	describe := fmt.Sprintf("请求在%.1f秒内将%s通道强度渐变到%d", seconds, channel, int(target))
+	err = h.confirmStrength(call, describe, func(caller coyote.Caller) error {
+		var err error
+		result, err = h.service.RampStrength(caller, channel, int(target), duration, curve, autoOff)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result.String(), nil
+}
+
+func (h *Handler) callFire(call *toolCall, args map[string]interface{}) (interface{}, error) {
+	channel, ok := args["channel"].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid channel")
+	}
+	delta, ok := args["delta"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("invalid delta")
+	}
+	seconds, ok := args["duration"].(float64)
+	if !ok || seconds <= 0 {
+		return nil, fmt.Errorf("invalid duration")
+	}
+	// pulse_id 可选，未提供时沿用当前波形
+	pulseID, _ := args["pulse_id"].(string)
+
+	if pulseID != "" {
+		if err := h.confirmPulse(call, pulseID); err != nil {
+			return nil, err
+		}
+	}
+
+	var result coyote.FireResult
+	duration := time.Duration(seconds * float64(time.Second))
+	describe := fmt.Sprintf("请求在%s通道叠加%+d强度，持续%.1f秒", channel, int(delta), seconds)
+	err := h.confirmStrength(call, describe, func(caller coyote.Caller) error {
+		var err error
+		result, err = h.service.Fire(caller, channel, int(delta), pulseID, duration)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if pulseID != "" {
+		h.markPulseUsed(call.session, pulseID)
+	}
+
+	return result.String(), nil
+}
+
+func (h *Handler) callCancelFire(args map[string]interface{}) (interface{}, error) {
+	// channel 可选，未提供时结束两个通道的叠加
+	channel, _ := args["channel"].(string)
+
+	err := h.service.CancelFire(channel)
+	if err != nil {
+		return nil, err
+	}
+
+	return "叠加已结束", nil
+}
+
+func (h *Handler) callCancelRamp(args map[string]interface{}) (interface{}, error) {
+	// channel 可选，未提供时取消两个通道
+	channel, _ := args["channel"].(string)
+
+	err := h.service.CancelRamp(channel)
+	if err != nil {
+		return nil, err
+	}
+
+	return "渐变已取消", nil
+}
+
+func (h *Handler) callEmergencyStop(args map[string]interface{}) (interface{}, error) {
+	// reason 可选
+	reason, _ := args["reason"].(string)
+	if reason == "" {
+		reason = "MCP emergency_stop"
+	}
+
+	err := h.service.EmergencyStop(reason)
+	if err != nil {
+		return nil, err
+	}
+
+	return "急停已触发，输出已归零并锁定，调用 rearm 解除", nil
+}
+
+func (h *Handler) callRearm(call *toolCall, args map[string]interface{}) (interface{}, error) {
+	// 解除急停必须由用户确认
+	if h.service.Stopped() {
+		if err := h.confirm(call, "请求解除急停，解除后强度从0开始，波形恢复播放。是否允许？"); err != nil {
+			return nil, err
+		}
+	}
+
+	err := h.service.Rearm()
+	if err != nil {
+		return nil, err
+	}
+
+	return "急停已解除", nil
+}
+
+func (h *Handler) callOpenLease(args map[string]interface{}) (interface{}, error) {
+	holder, ok := args["holder"].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid holder")
+	}
+	// ttl 可选，未提供时使用配置的默认值
+	seconds, _ := args["ttl"].(float64)
+
+	lease, err := h.service.OpenLease(holder, time.Duration(seconds*float64(time.Second)))
+	if err != nil {
+		return nil, err
+	}
+
+	return lease, nil
+}
+
+func (h *Handler) callRenewLease(args map[string]interface{}) (interface{}, error) {
+	id, ok := args["lease_id"].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid lease_id")
+	}
+
+	lease, err := h.service.RenewLease(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return lease, nil
+}
+
+func (h *Handler) callReleaseLease(args map[string]interface{}) (interface{}, error) {
+	id, ok := args["lease_id"].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid lease_id")
+	}
+
+	err := h.service.ReleaseLease(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return "租约已释放", nil
 }
 
 func (h *Handler) callSetLimit(args map[string]interface{}) (interface{}, error) {
@@ -302,20 +872,76 @@ func (h *Handler) callSetLimit(args map[string]interface{}) (interface{}, error)
 	return "上限设置成功", nil
 }
 
-func (h *Handler) callSetPulse(args map[string]interface{}) (interface{}, error) {
+func (h *Handler) callSetBalance(args map[string]interface{}) (interface{}, error) {
+	channel, ok := args["channel"].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid channel")
+	}
+
+	var frequencyBalance, intensityBalance *int
+	if v, ok := args["frequency_balance"].(float64); ok {
+		value := int(v)
+		frequencyBalance = &value
+	}
+	if v, ok := args["intensity_balance"].(float64); ok {
+		value := int(v)
+		intensityBalance = &value
+	}
+	if frequencyBalance == nil && intensityBalance == nil {
+		return nil, fmt.Errorf("frequency_balance 和 intensity_balance 至少提供一个")
+	}
+
+	err := h.service.SetBalance(channel, frequencyBalance, intensityBalance)
+	if err != nil {
+		return nil, err
+	}
+
+	return "平衡参数设置成功", nil
+}
+
+func (h *Handler) callSetPulse(call *toolCall, args map[string]interface{}) (interface{}, error) {
 	pulseID, ok := args["pulse_id"].(string)
 	if !ok {
 		return nil, fmt.Errorf("invalid pulse_id")
 	}
 
-	err := h.service.SetPulse(pulseID)
+	// channel 可选，未提供时两个通道使用同一波形
+	channel, _ := args["channel"].(string)
+
+	if err := h.confirmPulse(call, pulseID); err != nil {
+		return nil, err
+	}
+
+	err := h.service.SetPulse(channel, pulseID)
 	if err != nil {
 		return nil, err
 	}
+	h.markPulseUsed(call.session, pulseID)
 
 	return "波形设置成功", nil
 }
 
+func (h *Handler) callSetChannelEnabled(args map[string]interface{}) (interface{}, error) {
+	channel, ok := args["channel"].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid channel")
+	}
+	enabled, ok := args["enabled"].(bool)
+	if !ok {
+		return nil, fmt.Errorf("invalid enabled")
+	}
+
+	err := h.service.SetChannelEnabled(channel, enabled)
+	if err != nil {
+		return nil, err
+	}
+
+	if enabled {
+		return "通道已启用", nil
+	}
+	return "通道已禁用", nil
+}
+
 func (h *Handler) callGetStatus(args map[string]interface{}) (interface{}, error) {
 	status := h.service.GetStatus()
 	return status, nil
@@ -326,19 +952,208 @@ func (h *Handler) callListPulses(args map[string]interface{}) (interface{}, erro
 	return pulses, nil
 }
 
+func (h *Handler) callSaveScene(args map[string]interface{}) (interface{}, error) {
+	name, ok := args["name"].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid name")
+	}
+
+	return h.service.SaveScene(name)
+}
+
+func (h *Handler) callLoadScene(call *toolCall, args map[string]interface{}) (interface{}, error) {
+	name, ok := args["name"].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid name")
+	}
+
+	scenes, err := h.service.ListScenes()
+	if err != nil {
+		return nil, err
+	}
+	var pulses []string
+	for _, sc := range scenes {
+		if sc.Name != name {
+			continue
+		}
+		for _, ch := range []SceneChannel{sc.AChannel, sc.BChannel} {
+			if ch.Enabled && ch.Pulse != "" {
+				pulses = append(pulses, ch.Pulse)
+			}
+		}
+	}
+	for _, pulseID := range pulses {
+		if err := h.confirmPulse(call, pulseID); err != nil {
+			return nil, err
+		}
+	}
+
+	var result coyote.SceneResult
+	describe := fmt.Sprintf("请求加载场景%s", name)
+	err = h.confirmStrength(call, describe, func(caller coyote.Caller) error {
+		var err error
+		result, err = h.service.LoadScene(caller, name)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, pulseID := range pulses {
+		h.markPulseUsed(call.session, pulseID)
+	}
+
+	return result.String(), nil
+}
+
+func (h *Handler) callListScenes(args map[string]interface{}) (interface{}, error) {
+	return h.service.ListScenes()
+}
+
+func (h *Handler) callDeleteScene(args map[string]interface{}) (interface{}, error) {
+	name, ok := args["name"].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid name")
+	}
+
+	err := h.service.DeleteScene(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return "场景已删除", nil
+}
+
 // 辅助函数
-func (h *Handler) sendSSEMessage(w http.ResponseWriter, msg MCPMessage) {
-	data, _ := json.Marshal(msg)
-	fmt.Fprintf(w, "data: %s\n\n", data)
+
+// ClientID 识别请求来源：优先使用 X-Client-ID 请求头，否则使用客户端IP
+func ClientID(r *http.Request) string {
+	if id := r.Header.Get("X-Client-ID"); id != "" {
+		return id
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
 }
 
-func (h *Handler) sendJSONRPCResponse(w http.ResponseWriter, msg MCPMessage) {
+// LocalOrigin 判断浏览器请求的来源是否为本机，没有Origin头（非浏览器客户端）时允许
+// 所有HTTP端点都需要检查，防止用户访问的网页跨站POST控制设备
+func LocalOrigin(origin string) bool {
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	switch u.Hostname() {
+	case "localhost", "127.0.0.1", "::1":
+		return true
+	}
+	return false
+}
+
+// secondsArg 读取可选的秒数参数，未提供时返回0
+func secondsArg(args map[string]interface{}, name string) (time.Duration, error) {
+	value, ok := args[name]
+	if !ok {
+		return 0, nil
+	}
+	seconds, ok := value.(float64)
+	if !ok || seconds < 0 {
+		return 0, fmt.Errorf("invalid %s", name)
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// sendSSEEvent 发送带ID的SSE事件
+func (h *Handler) sendSSEEvent(w http.ResponseWriter, event sseEvent) {
+	data, _ := json.Marshal(event.msg)
+	fmt.Fprintf(w, "id: %d\ndata: %s\n\n", event.id, data)
+}
+
+// setCORSHeaders 设置跨域响应头，Streamable HTTP 和旧版SSE端点共用
+func (h *Handler) setCORSHeaders(w http.ResponseWriter) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Accept, X-Client-ID, Mcp-Session-Id, MCP-Protocol-Version, Last-Event-ID")
+	w.Header().Set("Access-Control-Expose-Headers", "Mcp-Session-Id")
+}
+
+// sendHTTPError 以HTTP状态码和JSON-RPC错误回应传输层的错误（如会话无效）
+func (h *Handler) sendHTTPError(w http.ResponseWriter, status int, message string) {
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(msg)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorResponse(nil, -32000, message))
 }
 
-func (h *Handler) sendJSONRPCError(w http.ResponseWriter, id interface{}, code int, message string) {
-	response := MCPMessage{
+// replier 请求结果的发送方式，HTTP响应和stdio各有实现
+type replier interface {
+	// request 在处理请求的过程中向客户端发送服务器请求（如确认请求），无法发送时返回错误
+	request(msg MCPMessage) error
+	// reply 发送请求的最终结果
+	reply(msg MCPMessage)
+}
+
+// httpReplier 通过HTTP响应发送结果：只有结果时直接返回JSON，需要先发送服务器请求时升级为SSE流
+type httpReplier struct {
+	h       *Handler
+	w       http.ResponseWriter
+	session *session
+	stream  string // 响应升级后的SSE流标识，为空表示尚未升级
+}
+
+// request 把响应升级为SSE流后发送服务器请求，最终结果也在这个流中发送
+func (r *httpReplier) request(msg MCPMessage) error {
+	flusher, ok := r.w.(http.Flusher)
+	if !ok {
+		return fmt.Errorf("连接不支持流式响应")
+	}
+	if r.stream == "" {
+		r.w.Header().Set("Content-Type", "text/event-stream")
+		r.w.Header().Set("Cache-Control", "no-cache")
+		r.w.WriteHeader(http.StatusOK)
+		r.stream = r.h.newStream(r.session)
+	}
+	r.send(msg)
+	flusher.Flush()
+	return nil
+}
+
+// reply 发送结果，响应已升级为SSE流时作为流中的最后一条消息发送
+func (r *httpReplier) reply(msg MCPMessage) {
+	if r.stream == "" {
+		r.h.sendJSONRPCResponse(r.w, msg)
+		return
+	}
+	r.send(msg)
+	if flusher, ok := r.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// send 以带ID的SSE事件发送消息，并保存到会话的事件缓冲，连接断开后客户端可以通过GET续传
+func (r *httpReplier) send(msg MCPMessage) {
+	r.h.mu.Lock()
+	event := r.h.recordEvent(r.session, r.stream, msg)
+	r.h.mu.Unlock()
+	r.h.sendSSEEvent(r.w, event)
+}
+
+// reply 发送工具调用的结果
+func (h *Handler) reply(call *toolCall, msg MCPMessage) {
+	call.out.reply(msg)
+}
+
+// replyError 发送工具调用的错误
+func (h *Handler) replyError(call *toolCall, code int, message string) {
+	h.reply(call, errorResponse(call.id, code, message))
+}
+
+// errorResponse 构造JSON-RPC错误回应
+func errorResponse(id interface{}, code int, message string) MCPMessage {
+	return MCPMessage{
 		JSONRPC: "2.0",
 		ID:      id,
 		Error: &MCPError{
@@ -346,6 +1161,15 @@ func (h *Handler) sendJSONRPCError(w http.ResponseWriter, id interface{}, code i
 			Message: message,
 		},
 	}
+}
+
+func (h *Handler) sendJSONRPCResponse(w http.ResponseWriter, msg MCPMessage) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(msg)
+}
+
+func (h *Handler) sendJSONRPCError(w http.ResponseWriter, id interface{}, code int, message string) {
+	response := errorResponse(id, code, message)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
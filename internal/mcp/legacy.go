@@ -0,0 +1,138 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// legacyOutbox 旧版SSE会话待发送消息的缓冲数
+// 写满说明客户端长时间没有读取SSE连接，会话被关闭，不让发送方（如向所有会话发送的资源更新通知）阻塞
+const legacyOutbox = 64
+
+// HandleSSE 旧版 HTTP+SSE 传输（2024-11-05）的GET /sse：每个连接是一个会话
+// 连接建立后先发送 endpoint 事件告知消息端点，之后的响应、服务器请求和通知都作为 message 事件发送，连接断开时会话结束
+func (h *Handler) HandleSSE(w http.ResponseWriter, r *http.Request) {
+	h.setCORSHeaders(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if !LocalOrigin(r.Header.Get("Origin")) {
+		h.sendHTTPError(w, http.StatusForbidden, "Origin not allowed")
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	outbox := make(chan MCPMessage, legacyOutbox)
+	s := h.newSession(func(s *session) {
+		s.ctx = ctx
+		s.push = func(msg MCPMessage) {
+			select {
+			case outbox <- msg:
+			case <-s.closed:
+			case <-ctx.Done():
+			default:
+				log.Printf("[会话] 旧版SSE会话 %s 的待发送消息已满，客户端未读取，关闭会话", s.id)
+				cancel()
+			}
+		}
+	})
+	defer h.endSession(s.id)
+	log.Printf("[会话] 客户端%s通过旧版SSE创建会话 %s", ClientID(r), s.id)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "event: endpoint\ndata: /messages?sessionId=%s\n\n", s.id)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case msg := <-outbox:
+			data, _ := json.Marshal(msg)
+			fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case <-s.closed:
+			return
+		case <-ctx.Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// HandleMessage 旧版 HTTP+SSE 传输的消息端点：POST /messages?sessionId=...
+// 收到后立即以202确认，处理结果通过该会话的SSE连接发送
+func (h *Handler) HandleMessage(w http.ResponseWriter, r *http.Request) {
+	h.setCORSHeaders(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if !LocalOrigin(r.Header.Get("Origin")) {
+		h.sendHTTPError(w, http.StatusForbidden, "Origin not allowed")
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	s := h.lookupSession(r.URL.Query().Get("sessionId"))
+	if s == nil || s.ctx == nil {
+		h.sendHTTPError(w, http.StatusNotFound, "Session not found")
+		return
+	}
+
+	var msg MCPMessage
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		h.sendJSONRPCError(w, nil, -32700, "Parse error")
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+
+	if msg.Method == "" && msg.ID != nil {
+		h.handleClientResponse(s, msg)
+		return
+	}
+	if msg.ID == nil {
+		return
+	}
+
+	// 工具调用可能等待用户确认，在后台处理，以便客户端继续POST确认结果
+	client := ClientID(r)
+	go h.dispatch(s.ctx, msg, client, s, &legacyReplier{h: h, session: s})
+}
+
+// legacyReplier 旧版SSE会话的回应方式：所有消息都通过会话的SSE连接发送
+type legacyReplier struct {
+	h       *Handler
+	session *session
+}
+
+func (r *legacyReplier) request(msg MCPMessage) error {
+	r.h.notify(r.session, msg)
+	return nil
+}
+
+func (r *legacyReplier) reply(msg MCPMessage) {
+	r.h.notify(r.session, msg)
+}
@@ -0,0 +1,233 @@
+package mcp
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PromptArgument 提示模板的参数
+type PromptArgument struct {
+	Name        string `json:"name" yaml:"name"`
+	Description string `json:"description,omitempty" yaml:"description"`
+	Required    bool   `json:"required,omitempty" yaml:"required"`
+	Default     string `json:"-" yaml:"default"` // 未传入时使用的值
+}
+
+// Prompt MCP提示模板定义
+type Prompt struct {
+	Name        string           `json:"name"`
+	Title       string           `json:"title,omitempty"`
+	Description string           `json:"description,omitempty"`
+	Arguments   []PromptArgument `json:"arguments,omitempty"`
+}
+
+// promptFile 提示模板文件中的一个模板，消息文本使用 text/template 语法
+type promptFile struct {
+	Name        string           `yaml:"name"`
+	Title       string           `yaml:"title"`
+	Description string           `yaml:"description"`
+	Arguments   []PromptArgument `yaml:"arguments"`
+	Messages    []struct {
+		Role string `yaml:"role"` // user 或 assistant
+		Text string `yaml:"text"`
+	} `yaml:"messages"`
+}
+
+// promptTemplate 解析后的提示模板
+type promptTemplate struct {
+	Prompt
+	roles     []string
+	templates []*template.Template
+}
+
+// promptData 渲染提示模板时可用的数据
+type promptData struct {
+	Args      map[string]string // 调用方传入的参数，未传入的取默认值
+	Pulses    []PulseInfo       // 按ID排序的可用波形
+	PulseList string            // 可用波形列表，每行一个
+	Status    DeviceStatus      // 当前设备状态
+	Channels  string            // 两个通道的启用状态、上限、强度和波形，每行一个
+}
+
+// loadPrompts 加载提示模板文件，文件不存在或无法解析时不提供提示模板
+func loadPrompts(path string) []*promptTemplate {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		log.Printf("加载提示模板失败: %v", err)
+		return nil
+	}
+
+	var files []promptFile
+	if err := yaml.Unmarshal(data, &files); err != nil {
+		log.Printf("无法解析提示模板文件%s，不提供提示模板: %v", path, err)
+		return nil
+	}
+
+	prompts := make([]*promptTemplate, 0, len(files))
+	seen := make(map[string]bool)
+	for _, f := range files {
+		p, err := parsePrompt(f)
+		if err == nil && seen[f.Name] {
+			err = fmt.Errorf("名称重复")
+		}
+		if err != nil {
+			log.Printf("提示模板文件%s中的模板%q无效，不提供提示模板: %v", path, f.Name, err)
+			return nil
+		}
+		seen[f.Name] = true
+		prompts = append(prompts, p)
+	}
+	log.Printf("已加载%d个提示模板", len(prompts))
+	return prompts
+}
+
+// parsePrompt 校验并解析一个提示模板
+func parsePrompt(f promptFile) (*promptTemplate, error) {
+	if f.Name == "" {
+		return nil, fmt.Errorf("名称不能为空")
+	}
+	if len(f.Messages) == 0 {
+		return nil, fmt.Errorf("至少需要一条消息")
+	}
+
+	p := &promptTemplate{Prompt: Prompt{
+		Name:        f.Name,
+		Title:       f.Title,
+		Description: f.Description,
+		Arguments:   f.Arguments,
+	}}
+	for i, m := range f.Messages {
+		if m.Role != "user" && m.Role != "assistant" {
+			return nil, fmt.Errorf("第%d条消息的角色必须是user或assistant: %q", i+1, m.Role)
+		}
+		tmpl, err := template.New(fmt.Sprintf("%s#%d", f.Name, i+1)).Option("missingkey=zero").Parse(m.Text)
+		if err != nil {
+			return nil, err
+		}
+		p.roles = append(p.roles, m.Role)
+		p.templates = append(p.templates, tmpl)
+	}
+	return p, nil
+}
+
+// handlePromptsList 列出提示模板
+func (h *Handler) handlePromptsList(out replier, msg MCPMessage) {
+	prompts := make([]Prompt, 0, len(h.prompts))
+	for _, p := range h.prompts {
+		prompts = append(prompts, p.Prompt)
+	}
+
+	out.reply(MCPMessage{JSONRPC: "2.0", ID: msg.ID, Result: map[string]interface{}{"prompts": prompts}})
+}
+
+// handlePromptsGet 用传入的参数、当前波形列表和通道状态渲染提示模板
+func (h *Handler) handlePromptsGet(out replier, msg MCPMessage) {
+	params, _ := msg.Params.(map[string]interface{})
+	name, _ := params["name"].(string)
+	arguments, _ := params["arguments"].(map[string]interface{})
+
+	var p *promptTemplate
+	for _, candidate := range h.prompts {
+		if candidate.Name == name {
+			p = candidate
+		}
+	}
+	if p == nil {
+		out.reply(errorResponse(msg.ID, -32602, "Unknown prompt: "+name))
+		return
+	}
+
+	args := make(map[string]string)
+	for _, arg := range p.Arguments {
+		value := ""
+		if v, ok := arguments[arg.Name]; ok {
+			value = strings.TrimSpace(fmt.Sprint(v))
+		}
+		if value == "" {
+			if arg.Required {
+				out.reply(errorResponse(msg.ID, -32602, "Missing required argument: "+arg.Name))
+				return
+			}
+			value = arg.Default
+		}
+		args[arg.Name] = value
+	}
+
+	data := h.promptData(args)
+	messages := make([]map[string]interface{}, 0, len(p.templates))
+	for i, tmpl := range p.templates {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			out.reply(errorResponse(msg.ID, -32603, err.Error()))
+			return
+		}
+		messages = append(messages, map[string]interface{}{
+			"role": p.roles[i],
+			"content": map[string]interface{}{
+				"type": "text",
+				"text": strings.TrimSpace(buf.String()),
+			},
+		})
+	}
+
+	out.reply(MCPMessage{
+		JSONRPC: "2.0",
+		ID:      msg.ID,
+		Result: map[string]interface{}{
+			"description": p.Description,
+			"messages":    messages,
+		},
+	})
+}
+
+// promptData 收集渲染提示模板用的当前状态
+func (h *Handler) promptData(args map[string]string) promptData {
+	pulses := h.service.ListPulses()
+	sort.Slice(pulses, func(i, j int) bool {
+		return pulses[i].ID < pulses[j].ID
+	})
+	names := make(map[string]string)
+	var pulseList []string
+	for _, p := range pulses {
+		names[p.ID] = p.Name
+		pulseList = append(pulseList, fmt.Sprintf("- %s（ID: %s）", p.Name, p.ID))
+	}
+
+	status := h.service.GetStatus()
+	channels := []string{
+		channelText("A", status.AChannel, names),
+		channelText("B", status.BChannel, names),
+	}
+
+	return promptData{
+		Args:      args,
+		Pulses:    pulses,
+		PulseList: strings.Join(pulseList, "\n"),
+		Status:    status,
+		Channels:  strings.Join(channels, "\n"),
+	}
+}
+
+// channelText 描述通道的启用状态、上限、强度和波形
+func channelText(channel string, ch ChannelStatus, pulseNames map[string]string) string {
+	if !ch.Enabled {
+		return fmt.Sprintf("- %s通道：已禁用", channel)
+	}
+	pulse := ch.Pulse
+	if name, ok := pulseNames[ch.Pulse]; ok {
+		pulse = fmt.Sprintf("%s（ID: %s）", name, ch.Pulse)
+	}
+	return fmt.Sprintf("- %s通道：强度上限%d，基础强度%d，实际输出%d，波形%s",
+		channel, ch.Limit, ch.Strength, ch.Output, pulse)
+}
@@ -0,0 +1,226 @@
+package mcp
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"mygodblab/internal/coyote"
+)
+
+// resourceNotifyInterval 两次资源变化通知之间的最短间隔，渐变等频繁的变化在间隔内合并
+const resourceNotifyInterval = 200 * time.Millisecond
+
+const (
+	statusURI        = "dglab://status"
+	channelURIPrefix = "dglab://channels/"
+	pulsesURI        = "dglab://pulses"
+	pulseURIPrefix   = "dglab://pulses/"
+)
+
+// Resource MCP资源定义
+type Resource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+// ResourceTemplate MCP资源模板定义
+type ResourceTemplate struct {
+	URITemplate string `json:"uriTemplate"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+// handleResourcesList 列出设备状态、两个通道、波形列表和每个波形的资源
+func (h *Handler) handleResourcesList(out replier, msg MCPMessage) {
+	resources := []Resource{
+		{URI: statusURI, Name: "设备状态", Description: "连接、急停、两个通道、电量、租约和输出时长的完整状态", MimeType: "application/json"},
+		{URI: channelURIPrefix + "A", Name: "A通道", Description: "A通道的启用状态、强度、实际输出、波形、上限和平衡参数", MimeType: "application/json"},
+		{URI: channelURIPrefix + "B", Name: "B通道", Description: "B通道的启用状态、强度、实际输出、波形、上限和平衡参数", MimeType: "application/json"},
+		{URI: pulsesURI, Name: "波形列表", Description: "所有可用波形的ID和名称", MimeType: "application/json"},
+	}
+	for _, p := range h.service.PulseLibrary() {
+		resources = append(resources, Resource{
+			URI:         pulseURIPrefix + p.ID,
+			Name:        "波形" + p.Name,
+			Description: "波形的每一帧数据及解码后的频率和强度",
+			MimeType:    "application/json",
+		})
+	}
+
+	out.reply(MCPMessage{JSONRPC: "2.0", ID: msg.ID, Result: map[string]interface{}{"resources": resources}})
+}
+
+// handleResourceTemplatesList 列出通道和波形的资源模板
+func (h *Handler) handleResourceTemplatesList(out replier, msg MCPMessage) {
+	templates := []ResourceTemplate{
+		{URITemplate: channelURIPrefix + "{channel}", Name: "通道", Description: "单个通道的状态，channel为A或B", MimeType: "application/json"},
+		{URITemplate: pulseURIPrefix + "{id}", Name: "波形", Description: "指定ID的波形的每一帧数据及解码后的频率和强度", MimeType: "application/json"},
+	}
+
+	out.reply(MCPMessage{JSONRPC: "2.0", ID: msg.ID, Result: map[string]interface{}{"resourceTemplates": templates}})
+}
+
+// handleResourcesRead 以JSON文本返回资源内容
+func (h *Handler) handleResourcesRead(out replier, msg MCPMessage) {
+	uri := resourceURI(msg)
+	content, ok := h.readResource(uri)
+	if !ok {
+		out.reply(errorResponse(msg.ID, -32002, "Resource not found: "+uri))
+		return
+	}
+	data, err := json.Marshal(content)
+	if err != nil {
+		out.reply(errorResponse(msg.ID, -32603, err.Error()))
+		return
+	}
+
+	out.reply(MCPMessage{
+		JSONRPC: "2.0",
+		ID:      msg.ID,
+		Result: map[string]interface{}{
+			"contents": []map[string]interface{}{
+				{
+					"uri":      uri,
+					"mimeType": "application/json",
+					"text":     string(data),
+				},
+			},
+		},
+	})
+}
+
+// handleResourcesSubscribe 订阅资源，资源变化时向该会话发送 notifications/resources/updated
+func (h *Handler) handleResourcesSubscribe(out replier, msg MCPMessage, s *session) {
+	uri := resourceURI(msg)
+	if _, ok := h.readResource(uri); !ok {
+		out.reply(errorResponse(msg.ID, -32002, "Resource not found: "+uri))
+		return
+	}
+
+	h.mu.Lock()
+	s.subscriptions[uri] = true
+	h.mu.Unlock()
+
+	out.reply(MCPMessage{JSONRPC: "2.0", ID: msg.ID, Result: map[string]interface{}{}})
+}
+
+// handleResourcesUnsubscribe 取消订阅资源
+func (h *Handler) handleResourcesUnsubscribe(out replier, msg MCPMessage, s *session) {
+	uri := resourceURI(msg)
+
+	h.mu.Lock()
+	delete(s.subscriptions, uri)
+	h.mu.Unlock()
+
+	out.reply(MCPMessage{JSONRPC: "2.0", ID: msg.ID, Result: map[string]interface{}{}})
+}
+
+// resourceURI 请求参数中的资源URI
+func resourceURI(msg MCPMessage) string {
+	params, _ := msg.Params.(map[string]interface{})
+	uri, _ := params["uri"].(string)
+	return uri
+}
+
+// readResource 获取资源内容，资源不存在时返回false
+func (h *Handler) readResource(uri string) (interface{}, bool) {
+	switch {
+	case uri == statusURI:
+		return h.service.GetStatus(), true
+	case uri == pulsesURI:
+		return h.service.ListPulses(), true
+	case strings.HasPrefix(uri, channelURIPrefix):
+		status := h.service.GetStatus()
+		switch strings.TrimPrefix(uri, channelURIPrefix) {
+		case "A":
+			return status.AChannel, true
+		case "B":
+			return status.BChannel, true
+		}
+	case strings.HasPrefix(uri, pulseURIPrefix):
+		p, err := h.service.GetPulse(strings.TrimPrefix(uri, pulseURIPrefix))
+		if err == nil {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// watchResources 订阅控制器事件，把变化的设备状态和通道资源通知给订阅了它们的会话
+// 波形库启动后不再变化，不需要监视；设备状态中剩余时间等随时间变化的字段不触发通知
+func (h *Handler) watchResources() {
+	events, _ := h.service.Subscribe()
+	previous := h.service.GetStatus()
+
+	for range events {
+		drainEvents(events)
+		current := h.service.GetStatus()
+		var changed []string
+		if statusChanged(previous, current) {
+			changed = append(changed, statusURI)
+		}
+		if previous.AChannel != current.AChannel {
+			changed = append(changed, channelURIPrefix+"A")
+		}
+		if previous.BChannel != current.BChannel {
+			changed = append(changed, channelURIPrefix+"B")
+		}
+		previous = current
+
+		for _, uri := range changed {
+			h.notifySubscribers(uri)
+		}
+		// 间隔内到达的事件留在通道中，下一轮合并处理
+		time.Sleep(resourceNotifyInterval)
+	}
+}
+
+// drainEvents 取走通道中已到达的事件，它们由同一次状态比较处理
+func drainEvents(events <-chan coyote.Event) {
+	for {
+		select {
+		case <-events:
+		default:
+			return
+		}
+	}
+}
+
+// statusChanged 设备状态中除剩余时间外的字段是否变化
+func statusChanged(previous, current DeviceStatus) bool {
+	return previous.Connected != current.Connected ||
+		previous.ConnectionState != current.ConnectionState ||
+		previous.Stopped != current.Stopped ||
+		previous.StopReason != current.StopReason ||
+		previous.AChannel != current.AChannel ||
+		previous.BChannel != current.BChannel ||
+		previous.BatteryLevel != current.BatteryLevel ||
+		(previous.Lease == nil) != (current.Lease == nil) ||
+		len(previous.Fires) != len(current.Fires)
+}
+
+// notifySubscribers 向订阅了资源的会话发送 notifications/resources/updated
+func (h *Handler) notifySubscribers(uri string) {
+	msg := MCPMessage{
+		JSONRPC: "2.0",
+		Method:  "notifications/resources/updated",
+		Params:  map[string]interface{}{"uri": uri},
+	}
+
+	h.mu.Lock()
+	var subscribers []*session
+	for _, s := range h.sessions {
+		if s.subscriptions[uri] {
+			subscribers = append(subscribers, s)
+		}
+	}
+	h.mu.Unlock()
+
+	for _, s := range subscribers {
+		h.notify(s, msg)
+	}
+}
@@ -1,8 +1,14 @@
 package mcp
 
 import (
+	"fmt"
+	"sort"
+	"time"
+
 	"mygodblab/internal/coyote"
-	// 移除未使用的 pulse 导入
+	"mygodblab/internal/protocol"
+	"mygodblab/internal/pulse"
+	"mygodblab/internal/scene"
 )
 
 // Service MCP服务层
@@ -15,9 +21,55 @@ func NewService(controller *coyote.Controller) *Service {
 	return &Service{controller: controller}
 }
 
-// SetStrength 设置通道强度
-func (s *Service) SetStrength(channel string, strength int) error {
-	return s.controller.SetStrength(channel, strength)
+// SetStrength 设置通道强度，immediate为false时向上跳变较大会自动渐变
+// autoOff大于0时在该时间后自动渐变归零；返回实际执行的结果
+func (s *Service) SetStrength(caller coyote.Caller, channel string, strength int, immediate bool, autoOff time.Duration) (coyote.StrengthResult, error) {
+	var result coyote.StrengthResult
+	var err error
+	if immediate {
+		result, err = s.controller.SetStrength(caller, channel, strength)
+	} else {
+		result, err = s.controller.SetStrengthSmooth(caller, channel, strength)
+	}
+	if err != nil {
+		return result, err
+	}
+	if autoOff > 0 {
+		return result, s.controller.SetAutoOff(channel, autoOff)
+	}
+	return result, nil
+}
+
+// RampStrength 在duration内按曲线将通道强度渐变到目标值
+// autoOff大于0时从现在起该时间后自动渐变归零；返回实际执行的结果
+func (s *Service) RampStrength(caller coyote.Caller, channel string, target int, duration time.Duration, curveName string, autoOff time.Duration) (coyote.StrengthResult, error) {
+	curve, err := coyote.ParseRampCurve(curveName)
+	if err != nil {
+		return coyote.StrengthResult{}, err
+	}
+	result, err := s.controller.RampStrength(caller, channel, target, duration, curve)
+	if err != nil {
+		return result, err
+	}
+	if autoOff > 0 {
+		return result, s.controller.SetAutoOff(channel, autoOff)
+	}
+	return result, nil
+}
+
+// CancelRamp 取消正在进行的渐变，channel为空时取消两个通道
+func (s *Service) CancelRamp(channel string) error {
+	return s.controller.CancelRamp(channel)
+}
+
+// EmergencyStop 急停：两个通道强度归零并锁定
+func (s *Service) EmergencyStop(reason string) error {
+	return s.controller.EmergencyStop(reason)
+}
+
+// Rearm 解除急停锁定
+func (s *Service) Rearm() error {
+	return s.controller.Rearm()
 }
 
 // SetLimit 设置通道强度上限
@@ -25,28 +77,179 @@ func (s *Service) SetLimit(channel string, limit int) error {
 	return s.controller.SetLimit(channel, limit)
 }
 
-// SetPulse 设置波形
-func (s *Service) SetPulse(pulseID string) error {
-	return s.controller.SetPulse(pulseID)
+// SetPulse 设置波形，channel为空时同时设置两个通道
+func (s *Service) SetPulse(channel string, pulseID string) error {
+	return s.controller.SetPulse(channel, pulseID)
+}
+
+// SetBalance 设置波形平衡参数，未提供的参数保持当前值
+func (s *Service) SetBalance(channel string, frequencyBalance, intensityBalance *int) error {
+	state := s.controller.GetStatus()
+
+	var freq, intensity int
+	switch channel {
+	case "A", "a":
+		freq, intensity = state.AFrequencyBalance, state.AIntensityBalance
+	case "B", "b":
+		freq, intensity = state.BFrequencyBalance, state.BIntensityBalance
+	default:
+		return fmt.Errorf("无效的通道: %s", channel)
+	}
+	if frequencyBalance != nil {
+		freq = *frequencyBalance
+	}
+	if intensityBalance != nil {
+		intensity = *intensityBalance
+	}
+
+	return s.controller.SetBalance(channel, freq, intensity)
+}
+
+// SetChannelEnabled 启用或禁用通道
+func (s *Service) SetChannelEnabled(channel string, enabled bool) error {
+	return s.controller.SetChannelEnabled(channel, enabled)
+}
+
+// Subscribe 订阅控制器事件，返回事件通道和取消订阅函数
+func (s *Service) Subscribe() (<-chan coyote.Event, func()) {
+	return s.controller.Subscribe()
+}
+
+// Stopped 是否处于急停锁定状态
+func (s *Service) Stopped() bool {
+	return s.controller.IsStopped()
 }
 
 // GetStatus 获取设备状态
 func (s *Service) GetStatus() DeviceStatus {
 	// 使用正确的方法名 GetStatus
 	channelState := s.controller.GetStatus()
+	conn := s.controller.ConnectionStatus()
+	stop := s.controller.StopStatus()
 
 	return DeviceStatus{
-		Connected: s.controller.IsConnected(),
+		Connected:       s.controller.IsConnected(),
+		ConnectionState: string(conn.State),
+		Reconnects:      conn.Reconnects,
+		LastError:       conn.LastError,
+		Stopped:         stop.Stopped,
+		StopReason:      stop.Reason,
 		AChannel: ChannelStatus{
-			Strength: channelState.AStrength,
-			Limit:    channelState.ALimit,
+			Enabled:          channelState.AEnabled,
+			Strength:         channelState.AStrength,
+			Output:           s.controller.OutputStrength("A"),
+			Pulse:            channelState.APulse,
+			Limit:            channelState.ALimit,
+			FrequencyBalance: channelState.AFrequencyBalance,
+			IntensityBalance: channelState.AIntensityBalance,
 		},
 		BChannel: ChannelStatus{
-			Strength: channelState.BStrength,
-			Limit:    channelState.BLimit,
+			Enabled:          channelState.BEnabled,
+			Strength:         channelState.BStrength,
+			Output:           s.controller.OutputStrength("B"),
+			Pulse:            channelState.BPulse,
+			Limit:            channelState.BLimit,
+			FrequencyBalance: channelState.BFrequencyBalance,
+			IntensityBalance: channelState.BIntensityBalance,
+		},
+		BatteryLevel:  channelState.BatteryLevel,
+		Lease:         s.leaseStatus(),
+		Session:       s.sessionInfo(),
+		Fires:         s.Fires(),
+		GuardRejected: s.controller.GuardRejected(),
+	}
+}
+
+// Fire 在通道上临时叠加强度和波形，duration后恢复
+func (s *Service) Fire(caller coyote.Caller, channel string, delta int, pulseID string, duration time.Duration) (coyote.FireResult, error) {
+	return s.controller.Fire(caller, channel, delta, pulseID, duration)
+}
+
+// CancelFire 立即移除临时叠加，channel为空时移除两个通道的叠加
+func (s *Service) CancelFire(channel string) error {
+	return s.controller.CancelFire(channel)
+}
+
+// Fires 正在生效的临时叠加
+func (s *Service) Fires() []FireInfo {
+	fires := []FireInfo{}
+	for _, f := range s.controller.FireStatus() {
+		fires = append(fires, FireInfo{
+			ID:               f.ID,
+			Channel:          f.Channel,
+			Delta:            f.Delta,
+			Pulse:            f.Pulse,
+			RemainingSeconds: f.Remaining.Seconds(),
+		})
+	}
+	return fires
+}
+
+// sessionInfo 输出时长限制状态
+func (s *Service) sessionInfo() SessionInfo {
+	session := s.controller.SessionStatus()
+	return SessionInfo{
+		ContinuousSeconds:          session.Continuous.Seconds(),
+		ContinuousRemainingSeconds: limitSeconds(session.ContinuousRemaining),
+		DailyUsedSeconds:           session.DailyUsed.Seconds(),
+		DailyRemainingSeconds:      limitSeconds(session.DailyRemaining),
+		CooldownRemainingSeconds:   session.CooldownRemaining.Seconds(),
+		AutoOffASeconds:            session.AutoOffA.Seconds(),
+		AutoOffBSeconds:            session.AutoOffB.Seconds(),
+	}
+}
+
+// limitSeconds 剩余时间转换为秒，未配置限制时为-1
+func limitSeconds(d time.Duration) float64 {
+	if d == coyote.Unlimited {
+		return -1
+	}
+	return d.Seconds()
+}
+
+// OpenLease 打开控制租约，ttl为0时使用配置的默认值
+func (s *Service) OpenLease(holder string, ttl time.Duration) (LeaseInfo, error) {
+	lease, err := s.controller.OpenLease(holder, ttl)
+	if err != nil {
+		return LeaseInfo{}, err
+	}
+	return newLeaseInfo(lease), nil
+}
+
+// RenewLease 续约控制租约
+func (s *Service) RenewLease(id string) (LeaseInfo, error) {
+	lease, err := s.controller.RenewLease(id)
+	if err != nil {
+		return LeaseInfo{}, err
+	}
+	return newLeaseInfo(lease), nil
+}
+
+// ReleaseLease 释放控制租约
+func (s *Service) ReleaseLease(id string) error {
+	return s.controller.ReleaseLease(id)
+}
+
+// leaseStatus 当前租约状态，不包含租约ID
+func (s *Service) leaseStatus() *LeaseStatus {
+	lease, ok := s.controller.LeaseStatus()
+	if !ok {
+		return nil
+	}
+	status := newLeaseInfo(lease).LeaseStatus
+	return &status
+}
+
+// newLeaseInfo 转换租约信息
+func newLeaseInfo(lease coyote.Lease) LeaseInfo {
+	return LeaseInfo{
+		LeaseID: lease.ID,
+		LeaseStatus: LeaseStatus{
+			Holder:           lease.Holder,
+			TTL:              lease.TTL.Seconds(),
+			ExpiresAt:        lease.Expires.Format(time.RFC3339),
+			RemainingSeconds: lease.Remaining().Seconds(),
 		},
-		CurrentPulse: channelState.CurrentPulse,
-		BatteryLevel: channelState.BatteryLevel,
 	}
 }
 
@@ -65,3 +268,90 @@ func (s *Service) ListPulses() []PulseInfo {
 
 	return result
 }
+
+// GetPulse 获取波形的完整数据
+func (s *Service) GetPulse(id string) (PulseDetail, error) {
+	p, err := s.controller.GetPulse(id)
+	if err != nil {
+		return PulseDetail{}, err
+	}
+	return pulseDetail(p), nil
+}
+
+// PulseLibrary 按ID排序的所有波形的完整数据
+func (s *Service) PulseLibrary() []PulseDetail {
+	pulses := s.controller.GetPulseList()
+	result := make([]PulseDetail, 0, len(pulses))
+	for _, p := range pulses {
+		result = append(result, pulseDetail(p))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
+
+// pulseDetail 解码波形的每一帧
+func pulseDetail(p *pulse.PulseData) PulseDetail {
+	detail := PulseDetail{
+		ID:     p.ID,
+		Name:   p.Name,
+		Frames: make([]PulseFrame, 0, len(p.PulseData)),
+	}
+	for _, hexData := range p.PulseData {
+		frame := PulseFrame{Hex: hexData}
+		waves, err := protocol.WaveDataFromHex(hexData)
+		if err != nil {
+			frame.Error = err.Error()
+		} else {
+			for _, wave := range waves {
+				frame.Frequency = append(frame.Frequency, int(wave.Frequency))
+				frame.Strength = append(frame.Strength, int(wave.Strength))
+			}
+		}
+		detail.Frames = append(detail.Frames, frame)
+	}
+	return detail
+}
+
+// SaveScene 将当前输出配置保存为场景
+func (s *Service) SaveScene(name string) (SceneInfo, error) {
+	saved, err := s.controller.SaveScene(name)
+	if err != nil {
+		return SceneInfo{}, err
+	}
+	return sceneInfo(saved), nil
+}
+
+// LoadScene 加载场景，强度渐变到场景中的值
+func (s *Service) LoadScene(caller coyote.Caller, name string) (coyote.SceneResult, error) {
+	return s.controller.LoadScene(caller, name)
+}
+
+// ListScenes 获取已保存的场景列表
+func (s *Service) ListScenes() ([]SceneInfo, error) {
+	scenes, err := s.controller.ListScenes()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]SceneInfo, 0, len(scenes))
+	for _, sc := range scenes {
+		result = append(result, sceneInfo(sc))
+	}
+	return result, nil
+}
+
+// DeleteScene 删除场景
+func (s *Service) DeleteScene(name string) error {
+	return s.controller.DeleteScene(name)
+}
+
+// sceneInfo 转换为MCP返回的场景信息
+func sceneInfo(sc scene.Scene) SceneInfo {
+	return SceneInfo{
+		Name:     sc.Name,
+		AChannel: SceneChannel(sc.AChannel),
+		BChannel: SceneChannel(sc.BChannel),
+		SavedAt:  sc.SavedAt.Format(time.RFC3339),
+	}
+}
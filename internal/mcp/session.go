@@ -0,0 +1,215 @@
+package mcp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"time"
+)
+
+// sessionIdleTimeout 没有请求也没有打开GET流的会话超过该时间后被清理
+const sessionIdleTimeout = time.Hour
+
+// maxBufferedEvents 每个会话保留的SSE事件数，用于断线后按 Last-Event-ID 续传
+const maxBufferedEvents = 256
+
+// getStream GET流在事件缓冲中的标识，POST响应升级的流以 post-N 标识
+const getStream = "get"
+
+// session MCP会话：记录客户端声明的能力、本次会话的状态和发往客户端的SSE事件
+// Streamable HTTP 会话在initialize时创建，以 Mcp-Session-Id 标识；旧版SSE会话随GET /sse 连接创建；
+// stdio模式下整个进程只有一个会话
+type session struct {
+	id              string
+	protocolVersion string          // 协商的协议版本，未初始化时为空
+	elicitation     bool            // 客户端支持 elicitation/create
+	usedPulses      map[string]bool // 本次会话中已使用或已确认的波形
+	subscriptions   map[string]bool // 通过 resources/subscribe 订阅的资源URI
+	lastSeen        time.Time       // 最近一次请求的时间
+
+	// push 直接发送服务器主动发起的消息（stdio、旧版SSE）；为nil时写入事件缓冲，由GET流发送
+	push func(msg MCPMessage)
+	// ctx 旧版SSE会话的连接上下文，POST到消息端点的请求在该上下文中处理，连接断开时取消
+	ctx context.Context
+
+	// 以下字段由 Handler.mu 保护
+	events     []sseEvent    // 最近发送的SSE事件
+	nextEvent  int           // 事件ID计数，在会话内唯一
+	nextStream int           // POST流编号计数
+	delivered  int           // GET流已发送到的事件ID
+	wake       chan struct{} // 有新的GET流事件时通知当前打开的GET流，没有打开时为nil
+	closed     chan struct{} // 会话结束时关闭
+}
+
+// sseEvent 发送过的SSE事件
+type sseEvent struct {
+	id     int
+	stream string // 所属的流
+	msg    MCPMessage
+}
+
+// newSession 创建并登记会话，同时清理长时间不活动的会话
+// setup 不为nil时在登记前调用，用于设置会话的发送方式
+func (h *Handler) newSession(setup func(s *session)) *session {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		// crypto/rand 在支持的平台上不会失败
+		panic(fmt.Sprintf("生成会话ID失败: %v", err))
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	for id, s := range h.sessions {
+		if s.wake == nil && s.push == nil && now.Sub(s.lastSeen) > sessionIdleTimeout {
+			log.Printf("[会话] %s 长时间不活动，已清理", id)
+			h.closeSession(s)
+		}
+	}
+
+	s := &session{
+		id:            hex.EncodeToString(buf),
+		usedPulses:    make(map[string]bool),
+		subscriptions: make(map[string]bool),
+		lastSeen:      now,
+		closed:        make(chan struct{}),
+	}
+	if setup != nil {
+		setup(s)
+	}
+	h.sessions[s.id] = s
+	return s
+}
+
+// lookupSession 获取会话并更新活动时间，不存在或已结束时返回nil
+func (h *Handler) lookupSession(id string) *session {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := h.sessions[id]
+	if s != nil {
+		s.lastSeen = time.Now()
+	}
+	return s
+}
+
+// endSession 结束会话，打开的GET流随之关闭，返回会话是否存在
+func (h *Handler) endSession(id string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.sessions[id]
+	if ok {
+		h.closeSession(s)
+	}
+	return ok
+}
+
+// closeSession 移除会话并通知打开的流退出，调用方需持有锁
+func (h *Handler) closeSession(s *session) {
+	delete(h.sessions, s.id)
+	close(s.closed)
+}
+
+// notify 向会话发送服务器主动发起的消息
+func (h *Handler) notify(s *session, msg MCPMessage) {
+	if s.push != nil {
+		s.push(msg)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.recordEvent(s, getStream, msg)
+}
+
+// recordEvent 分配事件ID并保存到事件缓冲，GET流的事件唤醒打开的GET流，调用方需持有锁
+func (h *Handler) recordEvent(s *session, stream string, msg MCPMessage) sseEvent {
+	s.nextEvent++
+	event := sseEvent{id: s.nextEvent, stream: stream, msg: msg}
+	s.events = append(s.events, event)
+	if len(s.events) > maxBufferedEvents {
+		s.events = s.events[len(s.events)-maxBufferedEvents:]
+	}
+
+	if stream == getStream && s.wake != nil {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+	return event
+}
+
+// newStream 为升级为SSE流的POST响应分配流标识
+func (h *Handler) newStream(s *session) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s.nextStream++
+	return fmt.Sprintf("post-%d", s.nextStream)
+}
+
+// attachStream 打开GET流，取代之前打开的GET流，返回唤醒通道和开始发送的位置
+// lastEventID 不为0时从该事件之后续传：续传的是POST流时先补发该流剩余的事件
+func (h *Handler) attachStream(s *session, lastEventID int) (chan struct{}, []sseEvent, int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if s.wake != nil {
+		close(s.wake)
+	}
+	s.wake = make(chan struct{}, 1)
+
+	cursor := s.delivered
+	var replay []sseEvent
+	if lastEventID > 0 {
+		stream := ""
+		for _, event := range s.events {
+			if event.id == lastEventID {
+				stream = event.stream
+			}
+		}
+		switch stream {
+		case "":
+			// 事件已不在缓冲中，无法续传，从未发送的事件开始
+		case getStream:
+			cursor = lastEventID
+		default:
+			for _, event := range s.events {
+				if event.stream == stream && event.id > lastEventID {
+					replay = append(replay, event)
+				}
+			}
+		}
+	}
+	return s.wake, replay, cursor
+}
+
+// detachStream GET流断开，之后的事件留在缓冲中，等下一次GET时发送
+func (h *Handler) detachStream(s *session, wake chan struct{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s.wake == wake {
+		s.wake = nil
+	}
+}
+
+// pendingEvents 获取GET流中ID大于cursor的事件，并记录已发送的位置
+func (h *Handler) pendingEvents(s *session, cursor int) []sseEvent {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var events []sseEvent
+	for _, event := range s.events {
+		if event.stream == getStream && event.id > cursor {
+			events = append(events, event)
+		}
+	}
+	if len(events) > 0 {
+		s.delivered = events[len(events)-1].id
+	}
+	return events
+}
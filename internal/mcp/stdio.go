@@ -0,0 +1,123 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"sync"
+)
+
+// stdioClient stdio模式下的客户端标识，一个进程只服务启动它的客户端
+const stdioClient = "stdio"
+
+// maxStdioMessage 单条消息的最大长度
+const maxStdioMessage = 1 << 20
+
+// ServeStdio 通过stdio提供MCP服务：从in逐行读取JSON-RPC消息，回应逐行写入out
+// 请求按收到的顺序逐个处理，流水线发送的强度指令不会乱序；读取不等待处理结果，
+// 请求等待用户确认时仍能读取客户端的回应。in关闭后等待进行中的请求结束再返回
+func (h *Handler) ServeStdio(in io.Reader, out io.Writer) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	replies := &stdioReplier{out: out}
+
+	// stdio整个连接就是一个会话，资源更新通知等服务器消息直接写入out
+	s := h.newSession(func(s *session) {
+		s.push = replies.reply
+	})
+	defer h.endSession(s.id)
+
+	var wg sync.WaitGroup
+	prev := make(chan struct{}) // 前一个排队请求处理完成时关闭
+	close(prev)
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxStdioMessage)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var msg MCPMessage
+		if err := json.Unmarshal(line, &msg); err != nil {
+			replies.reply(errorResponse(nil, -32700, "Parse error"))
+			continue
+		}
+
+		// 没有方法名的消息是客户端对服务器请求的回应
+		if msg.Method == "" && msg.ID != nil {
+			h.handleClientResponse(s, msg)
+			continue
+		}
+		// 通知不需要回应
+		if msg.ID == nil {
+			continue
+		}
+
+		wg.Add(1)
+		if bypassQueue(msg) {
+			go func() {
+				defer wg.Done()
+				h.dispatch(ctx, msg, stdioClient, s, replies)
+			}()
+			continue
+		}
+		wait, done := prev, make(chan struct{})
+		prev = done
+		go func() {
+			defer wg.Done()
+			defer close(done)
+			<-wait
+			h.dispatch(ctx, msg, stdioClient, s, replies)
+		}()
+	}
+
+	// 客户端已关闭输入，取消等待中的确认
+	cancel()
+	wg.Wait()
+	return scanner.Err()
+}
+
+// bypassQueue 急停不排在等待用户确认的请求之后，收到即处理
+// 急停锁存后排在它前面的提升强度请求都会被拒绝，越过队列不会造成乱序输出
+func bypassQueue(msg MCPMessage) bool {
+	if msg.Method != "tools/call" {
+		return false
+	}
+	params, _ := msg.Params.(map[string]interface{})
+	return params["name"] == "emergency_stop"
+}
+
+// stdioReplier 把消息逐行写入标准输出，多个请求并发处理时整行写入不会交错
+type stdioReplier struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+// request 直接发送服务器请求，客户端的回应从标准输入读取
+func (r *stdioReplier) request(msg MCPMessage) error {
+	return r.write(msg)
+}
+
+// reply 发送请求的结果
+func (r *stdioReplier) reply(msg MCPMessage) {
+	if err := r.write(msg); err != nil {
+		log.Printf("写入标准输出失败: %v", err)
+	}
+}
+
+// write 以一行JSON写入一条消息
+func (r *stdioReplier) write(msg MCPMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, err = r.out.Write(data)
+	return err
+}
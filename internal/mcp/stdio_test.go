@@ -0,0 +1,298 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"mygodblab/internal/config"
+	"mygodblab/internal/coyote"
+	"mygodblab/internal/transport"
+)
+
+// newTestHandler 创建使用模拟设备的Handler，配置文件都指向不存在的临时路径
+func newTestHandler(t *testing.T) *Handler {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.Transport.Type = transport.TypeSimulator
+	cfg.Pulses.ConfigPath = filepath.Join(dir, "pulses.yaml")
+	cfg.Policy.ConfigPath = filepath.Join(dir, "policy.yaml")
+	cfg.Scenes.ConfigPath = filepath.Join(dir, "scenes.yaml")
+	cfg.MCP.PromptsPath = filepath.Join(dir, "prompts.yaml")
+	cfg.MCP.ElicitationTimeout = 5
+	cfg.Ramp.AutoDelta = 0 // 直接跳变，调用返回后即可检查强度
+
+	controller, err := coyote.NewController(cfg)
+	if err != nil {
+		t.Fatalf("NewController() error = %v", err)
+	}
+	t.Cleanup(func() { controller.Close() })
+	return NewHandler(NewService(controller), cfg.MCP)
+}
+
+// decodeLines 解析逐行输出的消息，按请求ID索引
+func decodeLines(t *testing.T, out string) map[string]MCPMessage {
+	t.Helper()
+	replies := make(map[string]MCPMessage)
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		var msg MCPMessage
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			t.Fatalf("输出不是一行JSON: %q", line)
+		}
+		if msg.Method == "" {
+			replies[jsonID(msg.ID)] = msg
+		}
+	}
+	return replies
+}
+
+// jsonID 以JSON文本表示请求ID，null表示没有ID
+func jsonID(id interface{}) string {
+	data, _ := json.Marshal(id)
+	return string(data)
+}
+
+func TestServeStdio(t *testing.T) {
+	h := newTestHandler(t)
+	in := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{}}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		``,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"get_status","arguments":{}}}`,
+		`{"jsonrpc":"2.0","id":"3","method":"tools/call","params":{"name":"no_such_tool","arguments":{}}}`,
+		`not json`,
+	}, "\n")
+	var out bytes.Buffer
+
+	if err := h.ServeStdio(strings.NewReader(in), &out); err != nil {
+		t.Fatalf("ServeStdio() error = %v", err)
+	}
+	replies := decodeLines(t, out.String())
+	if len(replies) != 4 {
+		t.Fatalf("收到%d条回应, want 4:\n%s", len(replies), out.String())
+	}
+
+	init := replies["1"]
+	result, _ := init.Result.(map[string]interface{})
+	if init.Error != nil || result["protocolVersion"] != "2025-06-18" {
+		t.Errorf("initialize = %+v", init)
+	}
+
+	status := replies["2"]
+	result, _ = status.Result.(map[string]interface{})
+	content, _ := result["content"].([]interface{})
+	if status.Error != nil || len(content) != 1 {
+		t.Fatalf("get_status = %+v", status)
+	}
+	text, _ := content[0].(map[string]interface{})["text"].(string)
+	var device DeviceStatus
+	if err := json.Unmarshal([]byte(text), &device); err != nil {
+		t.Errorf("get_status 结果不是设备状态: %q", text)
+	}
+
+	if unknown := replies[`"3"`]; unknown.Error == nil && unknown.Result == nil {
+		t.Errorf("未知工具没有回应: %+v", unknown)
+	}
+	if parse := replies["null"]; parse.Error == nil || parse.Error.Code != -32700 {
+		t.Errorf("无法解析的消息 = %+v, want -32700", parse)
+	}
+}
+
+// stdioPeer 通过管道与ServeStdio交互的客户端
+type stdioPeer struct {
+	t     *testing.T
+	in    *io.PipeWriter
+	lines *bufio.Scanner
+	done  chan error
+}
+
+// startStdio 在后台运行ServeStdio，返回连接到它的客户端
+func startStdio(t *testing.T, h *Handler) *stdioPeer {
+	t.Helper()
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	p := &stdioPeer{t: t, in: inW, lines: bufio.NewScanner(outR), done: make(chan error, 1)}
+	go func() {
+		p.done <- h.ServeStdio(inR, outW)
+		outW.Close()
+	}()
+	return p
+}
+
+// send 写入一行消息
+func (p *stdioPeer) send(line string) {
+	p.t.Helper()
+	if _, err := io.WriteString(p.in, line+"\n"); err != nil {
+		p.t.Fatalf("写入输入失败: %v", err)
+	}
+}
+
+// until 读取输出直到出现满足条件的消息，跳过资源更新通知等其他消息
+func (p *stdioPeer) until(match func(MCPMessage) bool) MCPMessage {
+	p.t.Helper()
+	for p.lines.Scan() {
+		var msg MCPMessage
+		if err := json.Unmarshal(p.lines.Bytes(), &msg); err != nil {
+			p.t.Fatalf("输出不是一行JSON: %q", p.lines.Text())
+		}
+		if match(msg) {
+			return msg
+		}
+	}
+	p.t.Fatal("输出提前结束")
+	return MCPMessage{}
+}
+
+// close 关闭输入并等待ServeStdio返回
+func (p *stdioPeer) close() {
+	p.t.Helper()
+	p.in.Close()
+	for p.lines.Scan() {
+	}
+	if err := <-p.done; err != nil {
+		p.t.Errorf("ServeStdio() error = %v", err)
+	}
+}
+
+// replyTo 匹配对指定请求ID的回应
+func replyTo(id string) func(MCPMessage) bool {
+	return func(msg MCPMessage) bool { return msg.Method == "" && jsonID(msg.ID) == id }
+}
+
+// isElicitation 匹配服务器发出的确认请求
+func isElicitation(msg MCPMessage) bool {
+	return msg.Method == "elicitation/create"
+}
+
+func TestServeStdioElicitation(t *testing.T) {
+	h := newTestHandler(t)
+	p := startStdio(t, h)
+
+	p.send(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{"elicitation":{}}}}`)
+	if msg := p.until(replyTo("1")); msg.Error != nil {
+		t.Fatalf("initialize = %+v", msg)
+	}
+	p.send(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"emergency_stop","arguments":{}}}`)
+	if msg := p.until(replyTo("2")); msg.Error != nil {
+		t.Fatalf("emergency_stop = %+v", msg)
+	}
+
+	// 解除急停需要用户确认，确认请求直接写入输出
+	p.send(`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"rearm","arguments":{}}}`)
+	request := p.until(isElicitation)
+
+	// 回应不存在的请求ID不影响等待中的确认
+	p.send(`{"jsonrpc":"2.0","id":"elicit-0","result":{"action":"accept","content":{"confirm":true}}}`)
+	p.send(`{"jsonrpc":"2.0","id":` + jsonID(request.ID) + `,"result":{"action":"decline"}}`)
+	if msg := p.until(replyTo("3")); msg.Error == nil || !strings.Contains(msg.Error.Message, "拒绝") {
+		t.Errorf("用户拒绝后 rearm = %+v, want 错误", msg)
+	}
+	if !h.service.Stopped() {
+		t.Error("用户拒绝后急停被解除")
+	}
+
+	p.close()
+}
+
+func TestServeStdioConfirmStrength(t *testing.T) {
+	h := newTestHandler(t)
+	connectDevice(t, h)
+	p := startStdio(t, h)
+
+	p.send(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{"elicitation":{}}}}`)
+	if msg := p.until(replyTo("1")); msg.Error != nil {
+		t.Fatalf("initialize = %+v", msg)
+	}
+
+	tests := []struct {
+		name     string
+		strength int
+		answer   string // 对确认请求的回应
+		wantErr  bool
+		want     int // 调用结束后A通道的强度
+	}{
+		{"阈值以内不需要确认", 80, "", false, 80},
+		{"用户拒绝", 90, `{"action":"decline"}`, true, 80},
+		{"用户确认后重试", 90, `{"action":"accept","content":{"confirm":true}}`, false, 90},
+	}
+	for i, tt := range tests {
+		id := fmt.Sprint(i + 2)
+		p.send(fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"method":"tools/call","params":{"name":"set_strength","arguments":{"channel":"A","strength":%d}}}`, id, tt.strength))
+
+		if tt.answer != "" {
+			// 超过舒适阈值的强度先被策略要求确认，确认请求说明了原因
+			request := p.until(isElicitation)
+			params, _ := request.Params.(map[string]interface{})
+			if message, _ := params["message"].(string); !strings.Contains(message, "舒适阈值80") {
+				t.Errorf("%s: 确认请求 = %q, want 说明舒适阈值", tt.name, message)
+			}
+			p.send(`{"jsonrpc":"2.0","id":` + jsonID(request.ID) + `,"result":` + tt.answer + `}`)
+		}
+
+		msg := p.until(replyTo(id))
+		if gotErr := msg.Error != nil; gotErr != tt.wantErr {
+			t.Errorf("%s: set_strength = %+v, wantErr %v", tt.name, msg, tt.wantErr)
+		}
+		if got := h.service.GetStatus().AChannel.Strength; got != tt.want {
+			t.Errorf("%s: A通道强度 = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+
+	p.close()
+}
+
+// connectDevice 启动连接监管并等待模拟设备连接完成
+func connectDevice(t *testing.T, h *Handler) {
+	t.Helper()
+	h.service.controller.Start()
+	deadline := time.Now().Add(2 * time.Second)
+	for h.service.controller.ConnectionStatus().State != coyote.StateConnected {
+		if time.Now().After(deadline) {
+			t.Fatal("模拟设备没有连接")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestServeStdioKeepsOrder(t *testing.T) {
+	h := newTestHandler(t)
+	connectDevice(t, h)
+
+	// 流水线发送的强度指令按顺序执行，最后一条决定最终强度
+	var lines []string
+	for i := 1; i <= 10; i++ {
+		lines = append(lines, fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"tools/call","params":{"name":"set_strength","arguments":{"channel":"A","strength":%d}}}`, i, i*5))
+	}
+	var out bytes.Buffer
+	if err := h.ServeStdio(strings.NewReader(strings.Join(lines, "\n")), &out); err != nil {
+		t.Fatalf("ServeStdio() error = %v", err)
+	}
+
+	var ids []string
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var msg MCPMessage
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			t.Fatalf("输出不是一行JSON: %q", line)
+		}
+		if msg.Method != "" {
+			continue
+		}
+		if msg.Error != nil {
+			t.Errorf("请求%s = %+v", jsonID(msg.ID), msg.Error)
+		}
+		ids = append(ids, jsonID(msg.ID))
+	}
+	if got := strings.Join(ids, ","); got != "1,2,3,4,5,6,7,8,9,10" {
+		t.Errorf("回应顺序 = %s", got)
+	}
+	if status := h.service.GetStatus(); status.AChannel.Strength != 50 {
+		t.Errorf("A通道强度 = %d, want 50", status.AChannel.Strength)
+	}
+}
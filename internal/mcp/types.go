@@ -27,22 +27,77 @@ type SetLimitRequest struct {
 
 // SetPulseRequest 设置波形请求
 type SetPulseRequest struct {
+	Channel string `json:"channel"`  // 通道（A、B，为空表示两个通道）
 	PulseID string `json:"pulse_id"` // 波形ID
 }
 
+// SetBalanceRequest 设置波形平衡参数请求
+type SetBalanceRequest struct {
+	Channel          string `json:"channel"`           // 通道（A或B）
+	FrequencyBalance int    `json:"frequency_balance"` // 波形频率平衡参数（0-255）
+	IntensityBalance int    `json:"intensity_balance"` // 波形强度平衡参数（0-255）
+}
+
 // ChannelStatus 通道状态
 type ChannelStatus struct {
-	Strength int `json:"strength"` // 当前强度
-	Limit    int `json:"limit"`    // 强度上限
+	Enabled          bool   `json:"enabled"`           // 是否启用
+	Strength         int    `json:"strength"`          // 基础强度
+	Output           int    `json:"output"`            // 实际输出强度（基础强度加上临时叠加）
+	Pulse            string `json:"pulse"`             // 当前波形ID
+	Limit            int    `json:"limit"`             // 强度上限
+	FrequencyBalance int    `json:"frequency_balance"` // 波形频率平衡参数
+	IntensityBalance int    `json:"intensity_balance"` // 波形强度平衡参数
 }
 
 // DeviceStatus 设备状态
 type DeviceStatus struct {
-	Connected    bool          `json:"connected"`     // 连接状态
-	AChannel     ChannelStatus `json:"a_channel"`     // A通道状态
-	BChannel     ChannelStatus `json:"b_channel"`     // B通道状态
-	CurrentPulse string        `json:"current_pulse"` // 当前波形ID
-	BatteryLevel int           `json:"battery_level"` // 电量百分比
+	Connected       bool          `json:"connected"`        // 连接状态
+	ConnectionState string        `json:"connection_state"` // 连接状态(disconnected/scanning/connected/reconnecting)
+	Reconnects      int           `json:"reconnects"`       // 成功重连次数
+	LastError       string        `json:"last_error"`       // 最近一次连接失败或断线原因
+	Stopped         bool          `json:"stopped"`          // 是否处于急停锁定状态
+	StopReason      string        `json:"stop_reason"`      // 急停原因
+	AChannel        ChannelStatus `json:"a_channel"`        // A通道状态
+	BChannel        ChannelStatus `json:"b_channel"`        // B通道状态
+	BatteryLevel    int           `json:"battery_level"`    // 电量百分比
+	Lease           *LeaseStatus  `json:"lease"`            // 当前控制租约，无人持有时为null
+	Session         SessionInfo   `json:"session"`          // 输出时长限制状态
+	Fires           []FireInfo    `json:"fires"`            // 正在生效的临时叠加
+	GuardRejected   int           `json:"guard_rejected"`   // 输出守卫累计拒绝的帧数，不为0说明限制逻辑有缺陷
+}
+
+// FireInfo 临时叠加
+type FireInfo struct {
+	ID               int     `json:"id"`                // 叠加编号
+	Channel          string  `json:"channel"`           // 通道
+	Delta            int     `json:"delta"`             // 强度增量
+	Pulse            string  `json:"pulse"`             // 叠加波形，为空表示沿用基础波形
+	RemainingSeconds float64 `json:"remaining_seconds"` // 剩余时间(秒)
+}
+
+// SessionInfo 输出时长限制状态（秒），未配置的限制剩余时间为-1
+type SessionInfo struct {
+	ContinuousSeconds          float64 `json:"continuous_seconds"`           // 本次连续输出时长
+	ContinuousRemainingSeconds float64 `json:"continuous_remaining_seconds"` // 距离连续输出上限的剩余时间
+	DailyUsedSeconds           float64 `json:"daily_used_seconds"`           // 今日累计输出时长
+	DailyRemainingSeconds      float64 `json:"daily_remaining_seconds"`      // 距离每日累计上限的剩余时间
+	CooldownRemainingSeconds   float64 `json:"cooldown_remaining_seconds"`   // 冷却剩余时间，0表示未在冷却
+	AutoOffASeconds            float64 `json:"auto_off_a_seconds"`           // A通道距离自动关闭的剩余时间，0表示未设置
+	AutoOffBSeconds            float64 `json:"auto_off_b_seconds"`           // B通道距离自动关闭的剩余时间，0表示未设置
+}
+
+// LeaseStatus 控制租约状态
+type LeaseStatus struct {
+	Holder           string  `json:"holder"`            // 持有者
+	TTL              float64 `json:"ttl"`               // 续约窗口(秒)
+	ExpiresAt        string  `json:"expires_at"`        // 过期时间(RFC3339)
+	RemainingSeconds float64 `json:"remaining_seconds"` // 剩余时间(秒)
+}
+
+// LeaseInfo 打开或续约后返回给持有者的租约信息
+type LeaseInfo struct {
+	LeaseID string `json:"lease_id"` // 租约ID，续约和释放时使用
+	LeaseStatus
 }
 
 // PulseInfo 波形信息
@@ -50,3 +105,34 @@ type PulseInfo struct {
 	ID   string `json:"id"`   // 波形ID
 	Name string `json:"name"` // 波形名称
 }
+
+// PulseDetail 波形的完整数据，包含解码后的每一帧
+type PulseDetail struct {
+	ID     string       `json:"id"`     // 波形ID
+	Name   string       `json:"name"`   // 波形名称
+	Frames []PulseFrame `json:"frames"` // 按播放顺序排列的帧，每帧100ms
+}
+
+// PulseFrame 一帧波形数据，分为4个25ms的小节
+type PulseFrame struct {
+	Hex       string `json:"hex"`             // 原始十六进制数据
+	Frequency []int  `json:"frequency"`       // 各小节的频率(10-240)
+	Strength  []int  `json:"strength"`        // 各小节的波形强度(0-100)
+	Error     string `json:"error,omitempty"` // 数据无法解码时的原因，设备播放时以默认波形代替
+}
+
+// SceneInfo 已保存的场景
+type SceneInfo struct {
+	Name     string       `json:"name"`      // 场景名称
+	AChannel SceneChannel `json:"a_channel"` // A通道配置
+	BChannel SceneChannel `json:"b_channel"` // B通道配置
+	SavedAt  string       `json:"saved_at"`  // 保存时间(RFC3339)
+}
+
+// SceneChannel 场景中单个通道的配置
+type SceneChannel struct {
+	Enabled  bool   `json:"enabled"`  // 是否启用
+	Limit    int    `json:"limit"`    // 强度上限
+	Strength int    `json:"strength"` // 强度
+	Pulse    string `json:"pulse"`    // 波形ID
+}
@@ -0,0 +1,322 @@
+package policy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Action 受策略约束的控制器操作
+type Action string
+
+const (
+	ActionSetStrength  Action = "set_strength"  // 设置强度
+	ActionAddStrength  Action = "add_strength"  // 增加强度
+	ActionSubStrength  Action = "sub_strength"  // 减少强度
+	ActionRampStrength Action = "ramp_strength" // 强度渐变
+	ActionSetPulse     Action = "set_pulse"     // 更换波形，按新波形重新评估当前强度
+	ActionSetLimit     Action = "set_limit"     // 设置通道上限，上限不能超过绝对上限
+	ActionSetEnabled   Action = "set_enabled"   // 启用或禁用通道，按新的启用状态重新评估当前强度
+	ActionSetBalance   Action = "set_balance"   // 设置平衡参数，重新评估当前强度
+	ActionFire         Action = "fire"          // 临时叠加，评估叠加后的输出强度
+	ActionEnforce      Action = "enforce"       // 播放循环发帧前对当前强度的复核
+)
+
+// 规则类型
+const (
+	RuleCeiling       = "ceiling"        // 绝对强度上限
+	RulePulseMax      = "pulse_max"      // 指定波形的最大强度
+	RuleQuietHours    = "quiet_hours"    // 安静时段内的最大强度
+	RuleClientCeiling = "client_ceiling" // 指定客户端的最大强度
+	RuleConfirmAbove  = "confirm_above"  // 强度超过阈值时需要客户端确认
+)
+
+// 内置规则名，由控制器的动态状态产生
+const (
+	BuiltinProtocolRange   = "protocol_range"   // 协议强度范围0-200
+	BuiltinChannelDisabled = "channel_disabled" // 通道已禁用
+	BuiltinChannelLimit    = "channel_limit"    // 通道上限
+	BuiltinBatteryCap      = "battery_cap"      // 低电量限制
+	BuiltinCooldown        = "session_cooldown" // 输出时长冷却
+)
+
+// protocolMax 协议允许的最大强度
+const protocolMax = 200
+
+// Rule 一条策略规则
+type Rule struct {
+	Name      string `yaml:"name"`      // 规则名，记录在决策日志中
+	Type      string `yaml:"type"`      // 规则类型
+	Channel   string `yaml:"channel"`   // 适用通道A/B，为空表示两个通道
+	Max       int    `yaml:"max"`       // ceiling/pulse_max/quiet_hours/client_ceiling 的最大强度
+	Pulse     string `yaml:"pulse"`     // pulse_max 适用的波形ID
+	Client    string `yaml:"client"`    // client_ceiling 适用的客户端标识
+	Start     string `yaml:"start"`     // quiet_hours 开始时间(HH:MM)
+	End       string `yaml:"end"`       // quiet_hours 结束时间(HH:MM)，早于开始时间表示跨午夜
+	Threshold int    `yaml:"threshold"` // confirm_above 需要确认的强度阈值
+
+	startMin, endMin int // 解析后的安静时段(当天分钟数)
+}
+
+// File 策略文件结构
+type File struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// Request 一次待评估的操作
+type Request struct {
+	Action    Action    // 操作类型
+	Client    string    // 客户端标识，播放循环复核时为空
+	Channel   string    // 通道A/B
+	Current   int       // 当前强度
+	Target    int       // 请求的强度（set_limit时为请求的上限）
+	Pulse     string    // 通道波形ID（set_pulse时为新波形）
+	Confirmed bool      // 客户端已确认超过确认阈值的强度
+	Time      time.Time // 评估时间
+
+	// 控制器的动态约束，作为内置规则参与评估
+	Enabled  bool          // 通道是否启用
+	Limit    int           // 通道上限
+	Cap      int           // 低电量强度限制，小于0表示不限制
+	Cooldown time.Duration // 输出时长冷却剩余时间
+}
+
+// Decision 评估结果
+type Decision struct {
+	Allowed  bool   // 是否允许
+	Strength int    // 允许的强度（可能被规则调低）
+	Rule     string // 拒绝或调整请求的规则名，未触发规则时为空
+	Reason   string // 拒绝或调整的原因
+
+	NeedsConfirm bool // 因确认阈值被拒绝，用户确认后可以执行
+}
+
+// Engine 策略引擎
+type Engine struct {
+	rules []Rule
+}
+
+// NewEngine 创建策略引擎并校验规则
+func NewEngine(rules []Rule) (*Engine, error) {
+	for i := range rules {
+		if err := rules[i].validate(); err != nil {
+			return nil, fmt.Errorf("策略规则 %d(%s): %w", i+1, rules[i].Name, err)
+		}
+	}
+	return &Engine{rules: rules}, nil
+}
+
+// LoadEngine 从YAML策略文件创建策略引擎
+func LoadEngine(path string) (*Engine, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取策略文件失败: %w", err)
+	}
+
+	var file File
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("解析策略文件失败: %w", err)
+	}
+	return NewEngine(file.Rules)
+}
+
+// Rules 返回已加载的规则
+func (e *Engine) Rules() []Rule {
+	return append([]Rule(nil), e.rules...)
+}
+
+// Evaluate 评估一次操作并记录决策
+// 降低强度总是允许的；提升强度时取所有适用上限中最低的一个，并检查冷却和确认要求
+func (e *Engine) Evaluate(req Request) Decision {
+	d := e.evaluate(req)
+
+	// 播放循环复核只在规则生效时记录，避免每帧刷屏
+	if req.Action != ActionEnforce || d.Rule != "" {
+		logDecision(req, d)
+	}
+	return d
+}
+
+func (e *Engine) evaluate(req Request) Decision {
+	if req.Time.IsZero() {
+		req.Time = time.Now()
+	}
+	d := Decision{Allowed: true, Strength: req.Target}
+	// 播放循环复核、更换波形、启用通道和设置平衡参数不改变强度，按新状态对当前强度应用全部上限
+	review := req.Action == ActionEnforce || req.Action == ActionSetPulse ||
+		req.Action == ActionSetEnabled || req.Action == ActionSetBalance
+
+	if !req.Enabled && req.Action != ActionEnforce && req.Action != ActionSetLimit &&
+		req.Action != ActionSetEnabled && req.Action != ActionSetBalance {
+		return deny(BuiltinChannelDisabled, fmt.Sprintf("%s通道已禁用，请先启用该通道", req.Channel))
+	}
+
+	// 协议强度范围
+	if d.Strength < 0 {
+		d.Strength = 0
+	}
+	if d.Strength > protocolMax {
+		d.apply(protocolMax, BuiltinProtocolRange, "超过协议上限200")
+	}
+
+	// 设置上限只受绝对上限约束
+	if req.Action == ActionSetLimit {
+		for _, rule := range e.rules {
+			if rule.Type == RuleCeiling && rule.matchesChannel(req.Channel) {
+				d.apply(rule.Max, rule.Name, fmt.Sprintf("绝对上限%d", rule.Max))
+			}
+		}
+		return d
+	}
+
+	// 降低强度总是允许的，哪怕当前强度已高于某些上限；复核时对当前强度应用全部上限
+	if d.Strength <= req.Current && !review {
+		return d
+	}
+
+	if req.Cooldown > 0 && !review {
+		return deny(BuiltinCooldown, fmt.Sprintf("输出时长已达上限，冷却中，剩余%v", req.Cooldown.Round(time.Second)))
+	}
+
+	d.apply(req.Limit, BuiltinChannelLimit, fmt.Sprintf("通道上限%d", req.Limit))
+	if req.Cap >= 0 {
+		d.apply(req.Cap, BuiltinBatteryCap, fmt.Sprintf("低电量限制%d", req.Cap))
+	}
+
+	for _, rule := range e.rules {
+		if !rule.matchesChannel(req.Channel) {
+			continue
+		}
+		switch rule.Type {
+		case RuleCeiling:
+			d.apply(rule.Max, rule.Name, fmt.Sprintf("绝对上限%d", rule.Max))
+		case RulePulseMax:
+			if rule.Pulse == req.Pulse {
+				d.apply(rule.Max, rule.Name, fmt.Sprintf("波形%s最大强度%d", rule.Pulse, rule.Max))
+			}
+		case RuleQuietHours:
+			if rule.inQuietHours(req.Time) {
+				d.apply(rule.Max, rule.Name, fmt.Sprintf("安静时段%s-%s最大强度%d", rule.Start, rule.End, rule.Max))
+			}
+		case RuleClientCeiling:
+			if req.Client != "" && rule.Client == req.Client {
+				d.apply(rule.Max, rule.Name, fmt.Sprintf("客户端%s最大强度%d", rule.Client, rule.Max))
+			}
+		}
+	}
+
+	// 调整后的强度仍高于当前强度且超过确认阈值时，需要客户端确认
+	if d.Strength > req.Current && !req.Confirmed && !review {
+		for _, rule := range e.rules {
+			if rule.Type == RuleConfirmAbove && rule.matchesChannel(req.Channel) && d.Strength > rule.Threshold {
+				denied := deny(rule.Name, fmt.Sprintf("强度%d超过舒适阈值%d，需要用户确认", d.Strength, rule.Threshold))
+				denied.NeedsConfirm = true
+				return denied
+			}
+		}
+	}
+
+	return d
+}
+
+// apply 上限低于当前允许强度时调低，并记录生效的规则
+func (d *Decision) apply(ceiling int, rule, reason string) {
+	if d.Strength > ceiling {
+		d.Strength = ceiling
+		d.Rule = rule
+		d.Reason = reason
+	}
+}
+
+// deny 拒绝操作
+func deny(rule, reason string) Decision {
+	return Decision{Allowed: false, Rule: rule, Reason: reason}
+}
+
+// logDecision 记录决策及生效的规则
+func logDecision(req Request, d Decision) {
+	client := req.Client
+	if client == "" {
+		client = "-"
+	}
+	switch {
+	case !d.Allowed:
+		log.Printf("[策略] 拒绝 %s %s通道 %d->%d 客户端%s，规则 %s: %s",
+			req.Action, req.Channel, req.Current, req.Target, client, d.Rule, d.Reason)
+	case d.Rule != "":
+		log.Printf("[策略] 调整 %s %s通道 %d->%d 为%d 客户端%s，规则 %s: %s",
+			req.Action, req.Channel, req.Current, req.Target, d.Strength, client, d.Rule, d.Reason)
+	default:
+		log.Printf("[策略] 允许 %s %s通道 %d->%d 客户端%s",
+			req.Action, req.Channel, req.Current, req.Target, client)
+	}
+}
+
+// validate 校验规则字段并解析时间
+func (r *Rule) validate() error {
+	if r.Name == "" {
+		r.Name = r.Type
+	}
+	switch strings.ToUpper(r.Channel) {
+	case "", "A", "B":
+	default:
+		return fmt.Errorf("无效的通道: %s", r.Channel)
+	}
+	if r.Max < 0 || r.Max > protocolMax {
+		return fmt.Errorf("max 必须在0-200之间: %d", r.Max)
+	}
+
+	switch r.Type {
+	case RuleCeiling:
+	case RulePulseMax:
+		if r.Pulse == "" {
+			return fmt.Errorf("pulse_max 规则需要指定 pulse")
+		}
+	case RuleClientCeiling:
+		if r.Client == "" {
+			return fmt.Errorf("client_ceiling 规则需要指定 client")
+		}
+	case RuleQuietHours:
+		var err error
+		if r.startMin, err = parseClock(r.Start); err != nil {
+			return err
+		}
+		if r.endMin, err = parseClock(r.End); err != nil {
+			return err
+		}
+	case RuleConfirmAbove:
+		if r.Threshold < 0 || r.Threshold > protocolMax {
+			return fmt.Errorf("threshold 必须在0-200之间: %d", r.Threshold)
+		}
+	default:
+		return fmt.Errorf("未知的规则类型: %q", r.Type)
+	}
+	return nil
+}
+
+// matchesChannel 规则是否适用于通道
+func (r *Rule) matchesChannel(channel string) bool {
+	return r.Channel == "" || strings.EqualFold(r.Channel, channel)
+}
+
+// inQuietHours 判断时间是否在安静时段内，支持跨午夜的时段
+func (r *Rule) inQuietHours(t time.Time) bool {
+	now := t.Hour()*60 + t.Minute()
+	if r.startMin <= r.endMin {
+		return now >= r.startMin && now < r.endMin
+	}
+	return now >= r.startMin || now < r.endMin
+}
+
+// parseClock 解析HH:MM格式的时间，返回当天的分钟数
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("时间格式应为HH:MM: %q", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
@@ -0,0 +1,320 @@
+package policy
+
+import (
+	"testing"
+	"time"
+)
+
+// at 返回当天指定时刻
+func at(hour, minute int) time.Time {
+	return time.Date(2024, 1, 1, hour, minute, 0, 0, time.Local)
+}
+
+// request 返回启用通道、上限200、不受电量限制的请求
+func request(action Action, current, target int) Request {
+	return Request{
+		Action:  action,
+		Client:  "mcp",
+		Channel: "A",
+		Current: current,
+		Target:  target,
+		Pulse:   "p1",
+		Time:    at(12, 0),
+		Enabled: true,
+		Limit:   200,
+		Cap:     -1,
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	rules := []Rule{
+		{Name: "ceiling", Type: RuleCeiling, Max: 150},
+		{Name: "gentle", Type: RulePulseMax, Pulse: "p1", Max: 120},
+		{Name: "night", Type: RuleQuietHours, Start: "23:00", End: "07:00", Max: 40},
+		{Name: "remote", Type: RuleClientCeiling, Client: "remote", Max: 60},
+		{Name: "confirm", Type: RuleConfirmAbove, Threshold: 80},
+		{Name: "b_only", Type: RuleCeiling, Channel: "B", Max: 10},
+	}
+	engine, err := NewEngine(rules)
+	if err != nil {
+		t.Fatalf("NewEngine() error = %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		req          func() Request
+		wantAllowed  bool
+		wantStrength int
+		wantRule     string
+		wantConfirm  bool
+	}{
+		{
+			name:         "不超过任何上限",
+			req:          func() Request { return request(ActionSetStrength, 0, 50) },
+			wantAllowed:  true,
+			wantStrength: 50,
+		},
+		{
+			name: "取最低的上限",
+			req: func() Request {
+				r := request(ActionSetStrength, 0, 200)
+				r.Confirmed = true
+				return r
+			},
+			wantAllowed:  true,
+			wantStrength: 120,
+			wantRule:     "gentle",
+		},
+		{
+			name: "通道上限",
+			req: func() Request {
+				r := request(ActionSetStrength, 0, 70)
+				r.Limit = 30
+				return r
+			},
+			wantAllowed:  true,
+			wantStrength: 30,
+			wantRule:     BuiltinChannelLimit,
+		},
+		{
+			name: "低电量限制",
+			req: func() Request {
+				r := request(ActionSetStrength, 0, 70)
+				r.Cap = 25
+				return r
+			},
+			wantAllowed:  true,
+			wantStrength: 25,
+			wantRule:     BuiltinBatteryCap,
+		},
+		{
+			name: "客户端上限",
+			req: func() Request {
+				r := request(ActionSetStrength, 0, 70)
+				r.Client = "remote"
+				return r
+			},
+			wantAllowed:  true,
+			wantStrength: 60,
+			wantRule:     "remote",
+		},
+		{
+			name: "只适用于B通道的规则",
+			req: func() Request {
+				r := request(ActionSetStrength, 0, 50)
+				r.Channel = "b"
+				return r
+			},
+			wantAllowed:  true,
+			wantStrength: 10,
+			wantRule:     "b_only",
+		},
+		{
+			name: "安静时段跨午夜：开始之后",
+			req: func() Request {
+				r := request(ActionSetStrength, 0, 70)
+				r.Time = at(23, 30)
+				return r
+			},
+			wantAllowed:  true,
+			wantStrength: 40,
+			wantRule:     "night",
+		},
+		{
+			name: "安静时段跨午夜：午夜之后",
+			req: func() Request {
+				r := request(ActionSetStrength, 0, 70)
+				r.Time = at(6, 59)
+				return r
+			},
+			wantAllowed:  true,
+			wantStrength: 40,
+			wantRule:     "night",
+		},
+		{
+			name: "安静时段结束",
+			req: func() Request {
+				r := request(ActionSetStrength, 0, 70)
+				r.Time = at(7, 0)
+				return r
+			},
+			wantAllowed:  true,
+			wantStrength: 70,
+		},
+		{
+			name:        "超过确认阈值",
+			req:         func() Request { return request(ActionSetStrength, 0, 90) },
+			wantAllowed: false,
+			wantRule:    "confirm",
+			wantConfirm: true,
+		},
+		{
+			name: "已确认",
+			req: func() Request {
+				r := request(ActionSetStrength, 0, 90)
+				r.Confirmed = true
+				return r
+			},
+			wantAllowed:  true,
+			wantStrength: 90,
+		},
+		{
+			name: "调整后不超过阈值时不需要确认",
+			req: func() Request {
+				r := request(ActionSetStrength, 0, 90)
+				r.Time = at(1, 0)
+				return r
+			},
+			wantAllowed:  true,
+			wantStrength: 40,
+			wantRule:     "night",
+		},
+		{
+			name: "降低强度总是允许",
+			req: func() Request {
+				r := request(ActionSetStrength, 180, 160)
+				r.Time = at(1, 0)
+				r.Cooldown = time.Minute
+				return r
+			},
+			wantAllowed:  true,
+			wantStrength: 160,
+		},
+		{
+			name: "冷却中拒绝提升",
+			req: func() Request {
+				r := request(ActionSetStrength, 10, 20)
+				r.Cooldown = time.Minute
+				return r
+			},
+			wantAllowed: false,
+			wantRule:    BuiltinCooldown,
+		},
+		{
+			name: "通道禁用",
+			req: func() Request {
+				r := request(ActionSetStrength, 0, 10)
+				r.Enabled = false
+				return r
+			},
+			wantAllowed: false,
+			wantRule:    BuiltinChannelDisabled,
+		},
+		{
+			name: "复核对当前强度应用全部上限",
+			req: func() Request {
+				r := request(ActionEnforce, 100, 100)
+				r.Time = at(23, 0)
+				r.Cooldown = time.Minute
+				return r
+			},
+			wantAllowed:  true,
+			wantStrength: 40,
+			wantRule:     "night",
+		},
+		{
+			name:         "复核不要求确认",
+			req:          func() Request { return request(ActionEnforce, 100, 100) },
+			wantAllowed:  true,
+			wantStrength: 100,
+		},
+		{
+			name: "复核禁用的通道",
+			req: func() Request {
+				r := request(ActionEnforce, 0, 0)
+				r.Enabled = false
+				return r
+			},
+			wantAllowed:  true,
+			wantStrength: 0,
+		},
+		{
+			name:         "更换波形按新波形调低",
+			req:          func() Request { return request(ActionSetPulse, 130, 130) },
+			wantAllowed:  true,
+			wantStrength: 120,
+			wantRule:     "gentle",
+		},
+		{
+			name: "设置上限只受绝对上限约束",
+			req: func() Request {
+				r := request(ActionSetLimit, 0, 180)
+				r.Time = at(1, 0)
+				r.Enabled = false
+				return r
+			},
+			wantAllowed:  true,
+			wantStrength: 150,
+			wantRule:     "ceiling",
+		},
+		{
+			name:         "超过协议范围",
+			req:          func() Request { return request(ActionSetLimit, 0, 250) },
+			wantAllowed:  true,
+			wantStrength: 150,
+			wantRule:     "ceiling",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := engine.Evaluate(tt.req())
+			if d.Allowed != tt.wantAllowed || d.Rule != tt.wantRule || d.NeedsConfirm != tt.wantConfirm {
+				t.Fatalf("Evaluate() = %+v, want allowed=%v rule=%q confirm=%v",
+					d, tt.wantAllowed, tt.wantRule, tt.wantConfirm)
+			}
+			if d.Allowed && d.Strength != tt.wantStrength {
+				t.Errorf("Evaluate() strength = %d, want %d", d.Strength, tt.wantStrength)
+			}
+		})
+	}
+}
+
+func TestInQuietHours(t *testing.T) {
+	tests := []struct {
+		name       string
+		start, end string
+		time       time.Time
+		want       bool
+	}{
+		{"当天时段内", "13:00", "15:00", at(14, 0), true},
+		{"当天时段结束", "13:00", "15:00", at(15, 0), false},
+		{"当天时段之前", "13:00", "15:00", at(12, 59), false},
+		{"跨午夜开始", "22:00", "06:00", at(22, 0), true},
+		{"跨午夜零点", "22:00", "06:00", at(0, 0), true},
+		{"跨午夜结束", "22:00", "06:00", at(6, 0), false},
+		{"跨午夜白天", "22:00", "06:00", at(12, 0), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := Rule{Type: RuleQuietHours, Start: tt.start, End: tt.end}
+			if err := rule.validate(); err != nil {
+				t.Fatalf("validate() error = %v", err)
+			}
+			if got := rule.inQuietHours(tt.time); got != tt.want {
+				t.Errorf("inQuietHours(%s) = %v, want %v", tt.time.Format("15:04"), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewEngineInvalidRules(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+	}{
+		{"未知类型", Rule{Type: "unknown"}},
+		{"上限超出范围", Rule{Type: RuleCeiling, Max: 201}},
+		{"缺少波形", Rule{Type: RulePulseMax, Max: 10}},
+		{"缺少客户端", Rule{Type: RuleClientCeiling, Max: 10}},
+		{"时间格式错误", Rule{Type: RuleQuietHours, Start: "25:00", End: "07:00"}},
+		{"无效通道", Rule{Type: RuleCeiling, Channel: "C", Max: 10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewEngine([]Rule{tt.rule}); err == nil {
+				t.Error("NewEngine() error = nil")
+			}
+		})
+	}
+}
@@ -32,6 +32,11 @@ type B0Command struct {
 	BWaveData [4]WaveData  // B通道波形数据(4组)
 }
 
+// Command 可以写入设备的指令
+type Command interface {
+	ToBytes() []byte
+}
+
 // ToBytes 将B0指令转换为字节数组
 func (cmd *B0Command) ToBytes() []byte {
 	data := make([]byte, 20)
@@ -74,6 +79,110 @@ func (cmd *B0Command) ToBytes() []byte {
 	return data
 }
 
+// ParseB0Command 将字节数组解析为B0指令
+func ParseB0Command(data []byte) (*B0Command, error) {
+	if len(data) != 20 {
+		return nil, fmt.Errorf("B0指令长度错误，期望20字节，实际%d字节", len(data))
+	}
+	if data[0] != 0xB0 {
+		return nil, fmt.Errorf("不是B0指令: 0x%02X", data[0])
+	}
+
+	cmd := &B0Command{
+		Sequence:  data[1] >> 4,
+		AMode:     StrengthMode((data[1] >> 2) & 0b11),
+		BMode:     StrengthMode(data[1] & 0b11),
+		AStrength: data[2],
+		BStrength: data[3],
+	}
+	for i := 0; i < 4; i++ {
+		cmd.AWaveData[i] = WaveData{Frequency: data[4+i], Strength: data[8+i]}
+		cmd.BWaveData[i] = WaveData{Frequency: data[12+i], Strength: data[16+i]}
+	}
+
+	return cmd, nil
+}
+
+// BFCommand DG-LAB V3协议BF指令
+// 设置AB两通道的强度软上限以及波形频率平衡、波形强度平衡参数
+// 设备断电后不保存，每次连接后都需要重新写入
+type BFCommand struct {
+	ALimit            byte // A通道强度软上限 (0-200)
+	BLimit            byte // B通道强度软上限 (0-200)
+	AFrequencyBalance byte // A通道波形频率平衡参数 (0-255)
+	BFrequencyBalance byte // B通道波形频率平衡参数 (0-255)
+	AIntensityBalance byte // A通道波形强度平衡参数 (0-255)
+	BIntensityBalance byte // B通道波形强度平衡参数 (0-255)
+}
+
+// ToBytes 将BF指令转换为字节数组
+func (cmd *BFCommand) ToBytes() []byte {
+	return []byte{
+		0xBF,
+		cmd.ALimit,
+		cmd.BLimit,
+		cmd.AFrequencyBalance,
+		cmd.BFrequencyBalance,
+		cmd.AIntensityBalance,
+		cmd.BIntensityBalance,
+	}
+}
+
+// ParseBFCommand 将字节数组解析为BF指令
+func ParseBFCommand(data []byte) (*BFCommand, error) {
+	if len(data) != 7 {
+		return nil, fmt.Errorf("BF指令长度错误，期望7字节，实际%d字节", len(data))
+	}
+	if data[0] != 0xBF {
+		return nil, fmt.Errorf("不是BF指令: 0x%02X", data[0])
+	}
+
+	return &BFCommand{
+		ALimit:            data[1],
+		BLimit:            data[2],
+		AFrequencyBalance: data[3],
+		BFrequencyBalance: data[4],
+		AIntensityBalance: data[5],
+		BIntensityBalance: data[6],
+	}, nil
+}
+
+// B1Response DG-LAB V3协议B1回应消息
+// 设备强度发生变化（收到带序列号的B0指令或拨动实体滚轮）时通过通知特性返回
+type B1Response struct {
+	Sequence  byte // 对应B0指令的序列号，设备自身变化时为0
+	AStrength byte // A通道当前实际强度
+	BStrength byte // B通道当前实际强度
+}
+
+// ToBytes 将B1回应转换为字节数组
+func (r *B1Response) ToBytes() []byte {
+	return []byte{0xB1, r.Sequence, r.AStrength, r.BStrength}
+}
+
+// ParseB1Response 解析B1回应消息
+func ParseB1Response(data []byte) (*B1Response, error) {
+	if len(data) != 4 {
+		return nil, fmt.Errorf("B1回应长度错误，期望4字节，实际%d字节", len(data))
+	}
+	if data[0] != 0xB1 {
+		return nil, fmt.Errorf("不是B1回应: 0x%02X", data[0])
+	}
+
+	return &B1Response{
+		Sequence:  data[1],
+		AStrength: data[2],
+		BStrength: data[3],
+	}, nil
+}
+
+// InactiveWaveData 返回使通道不输出的波形数据
+// 协议规定：某通道波形强度大于100时，设备放弃该通道本次的全部4组波形数据
+func InactiveWaveData() [4]WaveData {
+	inactive := WaveData{Frequency: 10, Strength: 101}
+	return [4]WaveData{inactive, inactive, inactive, inactive}
+}
+
 // WaveDataFromHex 从十六进制字符串创建波形数据
 func WaveDataFromHex(hexStr string) ([4]WaveData, error) {
 	data, err := hex.DecodeString(hexStr)
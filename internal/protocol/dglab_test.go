@@ -0,0 +1,173 @@
+package protocol
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestB0CommandRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		cmd  B0Command
+	}{
+		{
+			name: "绝对设置",
+			cmd: B0Command{
+				Sequence:  5,
+				AMode:     StrengthModeAbsolute,
+				BMode:     StrengthModeNoChange,
+				AStrength: 120,
+				AWaveData: [4]WaveData{{10, 0}, {20, 25}, {30, 50}, {240, 100}},
+				BWaveData: InactiveWaveData(),
+			},
+		},
+		{
+			name: "相对增减",
+			cmd: B0Command{
+				Sequence:  15,
+				AMode:     StrengthModeIncrease,
+				BMode:     StrengthModeDecrease,
+				AStrength: 3,
+				BStrength: 200,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := tt.cmd.ToBytes()
+			if len(data) != 20 || data[0] != 0xB0 {
+				t.Fatalf("ToBytes() = %x", data)
+			}
+			parsed, err := ParseB0Command(data)
+			if err != nil {
+				t.Fatalf("ParseB0Command() error = %v", err)
+			}
+			if *parsed != tt.cmd {
+				t.Errorf("ParseB0Command() = %+v, want %+v", *parsed, tt.cmd)
+			}
+		})
+	}
+}
+
+func TestB0CommandLayout(t *testing.T) {
+	cmd := B0Command{Sequence: 1, AMode: StrengthModeAbsolute, BMode: StrengthModeIncrease, AStrength: 7, BStrength: 9}
+	data := cmd.ToBytes()
+	// 高4位序列号，低4位依次为A、B通道的强度解读方式
+	if data[1] != 0x1D {
+		t.Errorf("data[1] = 0x%02X, want 0x1D", data[1])
+	}
+	if data[2] != 7 || data[3] != 9 {
+		t.Errorf("强度字节 = %d %d, want 7 9", data[2], data[3])
+	}
+}
+
+func TestParseB0CommandInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"长度不足", make([]byte, 19)},
+		{"指令头错误", append([]byte{0xB1}, make([]byte, 19)...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseB0Command(tt.data); err == nil {
+				t.Error("ParseB0Command() error = nil")
+			}
+		})
+	}
+}
+
+func TestB1ResponseRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want B1Response
+	}{
+		{"指令回应", []byte{0xB1, 3, 20, 0}, B1Response{Sequence: 3, AStrength: 20}},
+		{"设备自身变化", []byte{0xB1, 0, 200, 150}, B1Response{AStrength: 200, BStrength: 150}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := ParseB1Response(tt.data)
+			if err != nil {
+				t.Fatalf("ParseB1Response() error = %v", err)
+			}
+			if *resp != tt.want {
+				t.Errorf("ParseB1Response() = %+v, want %+v", *resp, tt.want)
+			}
+			if got := resp.ToBytes(); !bytes.Equal(got, tt.data) {
+				t.Errorf("ToBytes() = %x, want %x", got, tt.data)
+			}
+		})
+	}
+}
+
+func TestParseB1ResponseInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"长度错误", []byte{0xB1, 0, 0}},
+		{"指令头错误", []byte{0xB0, 0, 0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseB1Response(tt.data); err == nil {
+				t.Error("ParseB1Response() error = nil")
+			}
+		})
+	}
+}
+
+func TestBFCommandRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		cmd  BFCommand
+		want []byte
+	}{
+		{
+			name: "默认参数",
+			cmd:  BFCommand{ALimit: 100, BLimit: 100, AFrequencyBalance: 160, BFrequencyBalance: 160},
+			want: []byte{0xBF, 100, 100, 160, 160, 0, 0},
+		},
+		{
+			name: "急停软上限",
+			cmd:  BFCommand{AFrequencyBalance: 255, BIntensityBalance: 255},
+			want: []byte{0xBF, 0, 0, 255, 0, 0, 255},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := tt.cmd.ToBytes()
+			if !bytes.Equal(data, tt.want) {
+				t.Fatalf("ToBytes() = %x, want %x", data, tt.want)
+			}
+			parsed, err := ParseBFCommand(data)
+			if err != nil {
+				t.Fatalf("ParseBFCommand() error = %v", err)
+			}
+			if *parsed != tt.cmd {
+				t.Errorf("ParseBFCommand() = %+v, want %+v", *parsed, tt.cmd)
+			}
+		})
+	}
+}
+
+func TestParseBFCommandInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"长度错误", []byte{0xBF, 0, 0, 0, 0, 0}},
+		{"指令头错误", []byte{0xB0, 0, 0, 0, 0, 0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseBFCommand(tt.data); err == nil {
+				t.Error("ParseBFCommand() error = nil")
+			}
+		})
+	}
+}
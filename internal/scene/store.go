@@ -0,0 +1,163 @@
+package scene
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Channel 场景中单个通道的配置
+type Channel struct {
+	Enabled  bool   `yaml:"enabled"`  // 是否启用
+	Limit    int    `yaml:"limit"`    // 强度上限
+	Strength int    `yaml:"strength"` // 强度
+	Pulse    string `yaml:"pulse"`    // 波形ID
+}
+
+// Scene 命名的输出配置，记录两个通道的启用状态、上限、强度和波形
+type Scene struct {
+	Name     string    `yaml:"name"`
+	AChannel Channel   `yaml:"a_channel"`
+	BChannel Channel   `yaml:"b_channel"`
+	SavedAt  time.Time `yaml:"saved_at"` // 保存时间
+}
+
+// Store 场景存储，所有场景保存在一个YAML文件中，每次修改后写回文件
+type Store struct {
+	mu     sync.Mutex
+	path   string
+	scenes map[string]*Scene
+}
+
+// NewStore 从文件加载场景，文件不存在时从空列表开始，首次保存时创建
+func NewStore(path string) (*Store, error) {
+	store := &Store{
+		path:   path,
+		scenes: make(map[string]*Scene),
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var scenes []*Scene
+	if err := yaml.Unmarshal(data, &scenes); err != nil {
+		return nil, fmt.Errorf("无法解析场景文件%s: %w", path, err)
+	}
+	for _, s := range scenes {
+		if err := validateName(s.Name); err != nil {
+			return nil, fmt.Errorf("场景文件%s: %w", path, err)
+		}
+		store.scenes[s.Name] = s
+	}
+	return store, nil
+}
+
+// Get 获取指定名称的场景
+func (s *Store) Get(name string) (Scene, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	scene, ok := s.scenes[name]
+	if !ok {
+		return Scene{}, fmt.Errorf("场景不存在: %s", name)
+	}
+	return *scene, nil
+}
+
+// List 按名称排序列出所有场景
+func (s *Store) List() []Scene {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sorted()
+}
+
+// Save 保存场景，同名场景被覆盖
+func (s *Store) Save(scene Scene) error {
+	if err := validateName(scene.Name); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, existed := s.scenes[scene.Name]
+	s.scenes[scene.Name] = &scene
+	if err := s.write(); err != nil {
+		if existed {
+			s.scenes[scene.Name] = previous
+		} else {
+			delete(s.scenes, scene.Name)
+		}
+		return err
+	}
+	return nil
+}
+
+// Delete 删除场景
+func (s *Store) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	scene, ok := s.scenes[name]
+	if !ok {
+		return fmt.Errorf("场景不存在: %s", name)
+	}
+	delete(s.scenes, name)
+	if err := s.write(); err != nil {
+		s.scenes[name] = scene
+		return err
+	}
+	return nil
+}
+
+// write 将所有场景写回文件，先写临时文件再替换，避免写到一半时损坏原文件，调用方需持有锁
+func (s *Store) write() error {
+	data, err := yaml.Marshal(s.sorted())
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("保存场景文件失败: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("保存场景文件失败: %w", err)
+	}
+	return nil
+}
+
+// sorted 按名称排序的场景副本，调用方需持有锁
+func (s *Store) sorted() []Scene {
+	scenes := make([]Scene, 0, len(s.scenes))
+	for _, scene := range s.scenes {
+		scenes = append(scenes, *scene)
+	}
+	sort.Slice(scenes, func(i, j int) bool {
+		return scenes[i].Name < scenes[j].Name
+	})
+	return scenes
+}
+
+// validateName 场景名称不能为空，且不能包含空白字符（控制台命令以空格分隔参数）
+func validateName(name string) error {
+	if name == "" {
+		return fmt.Errorf("场景名称不能为空")
+	}
+	if strings.ContainsAny(name, " \t\r\n") {
+		return fmt.Errorf("场景名称不能包含空白字符: %q", name)
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"mygodblab/internal/protocol"
+)
+
+// ErrFrameRejected 输出守卫拒绝写入的错误，不代表链路故障
+var ErrFrameRejected = errors.New("输出守卫拒绝写入")
+
+// guardAlarmInterval 相同原因的告警最短间隔，避免每帧都告警
+const guardAlarmInterval = time.Second
+
+// GuardState 输出守卫校验帧时依据的控制器状态
+// 由控制器提供，读取时不能等待控制器的状态锁，否则急停写入会被阻塞
+type GuardState struct {
+	Stopped  bool // 急停已锁存
+	ALimit   int  // A通道强度上限
+	BLimit   int  // B通道强度上限
+	AEnabled bool // A通道是否启用
+	BEnabled bool // B通道是否启用
+}
+
+// Guard 输出守卫：包装传输层，写入前独立解码每一帧并校验
+// 它不信任上层的限制逻辑，只按当前上限、通道启用状态、急停锁存和协议范围判断，
+// 违规的帧不会写入设备，并通过告警回调通知
+type Guard struct {
+	Transport
+
+	state func() GuardState   // 读取当前控制器状态
+	alarm func(reason string) // 拒绝写入时的告警回调
+
+	mu        sync.Mutex
+	aStrength int       // 已写入设备的A通道强度，用于计算相对变更后的强度
+	bStrength int       // 已写入设备的B通道强度
+	lastAlarm string    // 最近一次告警原因
+	alarmedAt time.Time // 最近一次告警时间
+	rejected  int       // 累计拒绝的帧数
+}
+
+// NewGuard 创建包装inner的输出守卫
+func NewGuard(inner Transport, state func() GuardState, alarm func(reason string)) *Guard {
+	return &Guard{
+		Transport: inner,
+		state:     state,
+		alarm:     alarm,
+	}
+}
+
+// WriteCharacteristic 校验通过后写入指令，违规时拒绝并告警
+func (g *Guard) WriteCharacteristic(data []byte) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	a, b, err := g.check(data, g.state())
+	if err != nil {
+		g.rejected++
+		g.raise(err.Error())
+		return fmt.Errorf("%w: %v", ErrFrameRejected, err)
+	}
+
+	if err := g.Transport.WriteCharacteristic(data); err != nil {
+		return err
+	}
+	g.aStrength, g.bStrength = a, b
+	return nil
+}
+
+// SetStrength 以设备的实际强度更新守卫跟踪的强度
+// 重新连接或收到设备回报（B1）后调用，之后的相对变更以此为基准校验
+func (g *Guard) SetStrength(a, b int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.aStrength, g.bStrength = a, b
+}
+
+// Rejected 返回累计拒绝的帧数
+func (g *Guard) Rejected() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.rejected
+}
+
+// check 解码并校验一条指令，返回写入后设备的预期强度，调用方需持有锁
+func (g *Guard) check(data []byte, state GuardState) (int, int, error) {
+	if len(data) == 0 {
+		return 0, 0, fmt.Errorf("空指令")
+	}
+
+	switch data[0] {
+	case 0xB0:
+		cmd, err := protocol.ParseB0Command(data)
+		if err != nil {
+			return 0, 0, err
+		}
+		a, err := checkChannel("A", cmd.AMode, cmd.AStrength, cmd.AWaveData, g.aStrength,
+			state.ALimit, state.AEnabled && !state.Stopped)
+		if err != nil {
+			return 0, 0, err
+		}
+		b, err := checkChannel("B", cmd.BMode, cmd.BStrength, cmd.BWaveData, g.bStrength,
+			state.BLimit, state.BEnabled && !state.Stopped)
+		if err != nil {
+			return 0, 0, err
+		}
+		return a, b, nil
+	case 0xBF:
+		cmd, err := protocol.ParseBFCommand(data)
+		if err != nil {
+			return 0, 0, err
+		}
+		if state.Stopped && (cmd.ALimit != 0 || cmd.BLimit != 0) {
+			return 0, 0, fmt.Errorf("急停期间软上限必须为0，帧中为A=%d B=%d", cmd.ALimit, cmd.BLimit)
+		}
+		if int(cmd.ALimit) > state.ALimit {
+			return 0, 0, fmt.Errorf("A通道软上限%d超过当前上限%d", cmd.ALimit, state.ALimit)
+		}
+		if int(cmd.BLimit) > state.BLimit {
+			return 0, 0, fmt.Errorf("B通道软上限%d超过当前上限%d", cmd.BLimit, state.BLimit)
+		}
+		// 设备按新软上限截断当前强度
+		return min(g.aStrength, int(cmd.ALimit)), min(g.bStrength, int(cmd.BLimit)), nil
+	default:
+		return 0, 0, fmt.Errorf("未知指令: 0x%02X", data[0])
+	}
+}
+
+// checkChannel 校验单个通道的强度和波形，返回写入后设备的预期强度
+// active为false（通道禁用或急停）时不允许提升强度，波形必须是不输出的标记
+func checkChannel(channel string, mode protocol.StrengthMode, value byte, waves [4]protocol.WaveData,
+	current, limit int, active bool) (int, error) {
+	strength := current
+	switch mode {
+	case protocol.StrengthModeIncrease:
+		strength = current + int(value)
+	case protocol.StrengthModeDecrease:
+		strength = max(current-int(value), 0)
+	case protocol.StrengthModeAbsolute:
+		strength = int(value)
+	}
+
+	if !active {
+		if strength > 0 && (mode == protocol.StrengthModeIncrease || mode == protocol.StrengthModeAbsolute) {
+			return 0, fmt.Errorf("%s通道已禁用或急停中，帧中强度为%d", channel, strength)
+		}
+		if !inactiveWaves(waves) {
+			return 0, fmt.Errorf("%s通道已禁用或急停中，帧中仍有输出波形", channel)
+		}
+		return strength, nil
+	}
+
+	if mode != protocol.StrengthModeNoChange && strength > limit {
+		return 0, fmt.Errorf("%s通道强度%d超过当前上限%d", channel, strength, limit)
+	}
+	if strength > 200 {
+		return 0, fmt.Errorf("%s通道强度%d超出协议范围0-200", channel, strength)
+	}
+	if inactiveWaves(waves) {
+		return strength, nil
+	}
+	for i, wave := range waves {
+		if wave.Frequency < 10 || wave.Frequency > 240 {
+			return 0, fmt.Errorf("%s通道第%d组波形频率%d超出范围10-240", channel, i+1, wave.Frequency)
+		}
+		if wave.Strength > 100 {
+			return 0, fmt.Errorf("%s通道第%d组波形强度%d超出范围0-100", channel, i+1, wave.Strength)
+		}
+	}
+	return strength, nil
+}
+
+// inactiveWaves 判断波形是否为不输出的标记（4组波形强度都大于100）
+// 只有部分组超过100的波形视为错误数据，而不是有意的标记
+func inactiveWaves(waves [4]protocol.WaveData) bool {
+	for _, wave := range waves {
+		if wave.Strength <= 100 {
+			return false
+		}
+	}
+	return true
+}
+
+// raise 触发告警，相同原因在间隔内只告警一次，调用方需持有锁
+func (g *Guard) raise(reason string) {
+	now := time.Now()
+	if reason == g.lastAlarm && now.Sub(g.alarmedAt) < guardAlarmInterval {
+		return
+	}
+	g.lastAlarm = reason
+	g.alarmedAt = now
+	if g.alarm != nil {
+		g.alarm(reason)
+	}
+}
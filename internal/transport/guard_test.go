@@ -0,0 +1,196 @@
+package transport
+
+import (
+	"errors"
+	"testing"
+
+	"mygodblab/internal/protocol"
+)
+
+// recorder 记录写入帧的传输层
+type recorder struct {
+	Transport
+	writes [][]byte
+}
+
+func (r *recorder) WriteCharacteristic(data []byte) error {
+	r.writes = append(r.writes, data)
+	return nil
+}
+
+// activeWaves 返回一组合法的输出波形
+func activeWaves() [4]protocol.WaveData {
+	return [4]protocol.WaveData{{Frequency: 10, Strength: 20}, {Frequency: 10, Strength: 20}, {Frequency: 10, Strength: 20}, {Frequency: 10, Strength: 20}}
+}
+
+// b0 返回只设置A通道强度的B0指令
+func b0(mode protocol.StrengthMode, strength byte) []byte {
+	cmd := protocol.B0Command{
+		AMode:     mode,
+		BMode:     protocol.StrengthModeNoChange,
+		AStrength: strength,
+		AWaveData: activeWaves(),
+		BWaveData: protocol.InactiveWaveData(),
+	}
+	return cmd.ToBytes()
+}
+
+// newTestGuard 创建两个通道都启用、上限50的守卫
+func newTestGuard(state *GuardState) (*Guard, *recorder, *[]string) {
+	*state = GuardState{ALimit: 50, BLimit: 50, AEnabled: true, BEnabled: true}
+	inner := &recorder{}
+	var alarms []string
+	guard := NewGuard(inner, func() GuardState { return *state }, func(reason string) {
+		alarms = append(alarms, reason)
+	})
+	return guard, inner, &alarms
+}
+
+func TestGuardWriteCharacteristic(t *testing.T) {
+	tests := []struct {
+		name    string
+		start   int // 守卫跟踪的A通道强度
+		setup   func(*GuardState)
+		data    []byte
+		wantErr bool
+	}{
+		{
+			name: "上限以内",
+			data: b0(protocol.StrengthModeAbsolute, 50),
+		},
+		{
+			name:    "超过上限",
+			data:    b0(protocol.StrengthModeAbsolute, 51),
+			wantErr: true,
+		},
+		{
+			name:    "相对提升超过上限",
+			start:   45,
+			data:    b0(protocol.StrengthModeIncrease, 6),
+			wantErr: true,
+		},
+		{
+			name:  "相对降低",
+			start: 45,
+			data:  b0(protocol.StrengthModeDecrease, 60),
+		},
+		{
+			name:    "急停期间有输出",
+			setup:   func(s *GuardState) { s.Stopped = true },
+			data:    b0(protocol.StrengthModeAbsolute, 10),
+			wantErr: true,
+		},
+		{
+			name:  "急停期间清零",
+			start: 30,
+			setup: func(s *GuardState) { s.Stopped = true },
+			data: (&protocol.B0Command{
+				AMode:     protocol.StrengthModeAbsolute,
+				BMode:     protocol.StrengthModeAbsolute,
+				AWaveData: protocol.InactiveWaveData(),
+				BWaveData: protocol.InactiveWaveData(),
+			}).ToBytes(),
+		},
+		{
+			name:    "禁用通道有输出",
+			setup:   func(s *GuardState) { s.AEnabled = false },
+			data:    b0(protocol.StrengthModeNoChange, 0),
+			wantErr: true,
+		},
+		{
+			name: "波形频率超出范围",
+			data: (&protocol.B0Command{
+				AMode:     protocol.StrengthModeAbsolute,
+				AStrength: 10,
+				AWaveData: [4]protocol.WaveData{{Frequency: 5, Strength: 20}, {Frequency: 10, Strength: 20}, {Frequency: 10, Strength: 20}, {Frequency: 10, Strength: 20}},
+				BWaveData: protocol.InactiveWaveData(),
+			}).ToBytes(),
+			wantErr: true,
+		},
+		{
+			name: "软上限以内",
+			data: (&protocol.BFCommand{ALimit: 50, BLimit: 20}).ToBytes(),
+		},
+		{
+			name:    "软上限超过当前上限",
+			data:    (&protocol.BFCommand{ALimit: 60}).ToBytes(),
+			wantErr: true,
+		},
+		{
+			name:    "急停期间软上限不为0",
+			setup:   func(s *GuardState) { s.Stopped = true },
+			data:    (&protocol.BFCommand{BLimit: 1}).ToBytes(),
+			wantErr: true,
+		},
+		{
+			name:    "未知指令",
+			data:    []byte{0xB2, 0},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var state GuardState
+			guard, inner, alarms := newTestGuard(&state)
+			guard.SetStrength(tt.start, 0)
+			if tt.setup != nil {
+				tt.setup(&state)
+			}
+
+			err := guard.WriteCharacteristic(tt.data)
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("WriteCharacteristic() error = %v", err)
+				}
+				if len(inner.writes) != 1 {
+					t.Errorf("写入%d帧, want 1", len(inner.writes))
+				}
+				return
+			}
+			if !errors.Is(err, ErrFrameRejected) {
+				t.Fatalf("WriteCharacteristic() error = %v, want ErrFrameRejected", err)
+			}
+			if len(inner.writes) != 0 {
+				t.Errorf("被拒绝的帧写入了设备")
+			}
+			if guard.Rejected() != 1 || len(*alarms) != 1 {
+				t.Errorf("Rejected() = %d, 告警%d次, want 1 1", guard.Rejected(), len(*alarms))
+			}
+		})
+	}
+}
+
+func TestGuardTracksStrength(t *testing.T) {
+	var state GuardState
+	guard, _, _ := newTestGuard(&state)
+
+	if err := guard.WriteCharacteristic(b0(protocol.StrengthModeAbsolute, 40)); err != nil {
+		t.Fatalf("WriteCharacteristic() error = %v", err)
+	}
+	// 以写入后的40为基准，+20超过上限
+	if err := guard.WriteCharacteristic(b0(protocol.StrengthModeIncrease, 20)); err == nil {
+		t.Fatal("相对提升超过上限未被拒绝")
+	}
+
+	// 设备回报强度降到了10，+20不再超过上限
+	guard.SetStrength(10, 0)
+	if err := guard.WriteCharacteristic(b0(protocol.StrengthModeIncrease, 20)); err != nil {
+		t.Errorf("SetStrength后 WriteCharacteristic() error = %v", err)
+	}
+}
+
+func TestGuardRejectedAlarmInterval(t *testing.T) {
+	var state GuardState
+	guard, _, alarms := newTestGuard(&state)
+
+	for i := 0; i < 3; i++ {
+		guard.WriteCharacteristic(b0(protocol.StrengthModeAbsolute, 100))
+	}
+	if guard.Rejected() != 3 {
+		t.Errorf("Rejected() = %d, want 3", guard.Rejected())
+	}
+	if len(*alarms) != 1 {
+		t.Errorf("相同原因告警%d次, want 1", len(*alarms))
+	}
+}
@@ -0,0 +1,248 @@
+package transport
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"mygodblab/internal/protocol"
+)
+
+// batteryDrainInterval 模拟设备在有输出时每消耗1%电量所需的时间
+const batteryDrainInterval = time.Minute
+
+// Simulator 内存中的模拟郊狼V3设备
+// 解析收到的B0/BF指令，维护设备内部强度状态，并像真实设备一样回应B1消息
+type Simulator struct {
+	mu        sync.Mutex
+	connected bool
+	aStrength int // A通道当前强度
+	bStrength int // B通道当前强度
+	aLimit    int // A通道软上限(BF指令设置)
+	bLimit    int // B通道软上限(BF指令设置)
+	aWave     [4]protocol.WaveData
+	bWave     [4]protocol.WaveData
+	battery   int           // 电量百分比
+	outputFor time.Duration // 累计输出时间，用于模拟电量消耗
+	lastWrite time.Time     // 上次收到指令的时间
+	frames    int           // 收到的B0帧数
+	notify    chan []byte   // 通知消息通道
+	batteryCh chan int      // 电量变化通道
+}
+
+// NewSimulator 创建模拟设备
+func NewSimulator() *Simulator {
+	return &Simulator{
+		aLimit:    200,
+		bLimit:    200,
+		battery:   100,
+		notify:    make(chan []byte, 16),
+		batteryCh: make(chan int, 4),
+	}
+}
+
+// Enable 模拟设备无需启用适配器
+func (s *Simulator) Enable() error {
+	log.Println("使用模拟设备，无需蓝牙适配器")
+	return nil
+}
+
+// ScanAndConnect 模拟扫描并立即连接成功
+func (s *Simulator) ScanAndConnect(timeout time.Duration, deviceNames []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.connected = true
+	s.lastWrite = time.Now()
+	s.publishBattery()
+	log.Println("模拟设备连接完成！")
+	return nil
+}
+
+// WriteCharacteristic 接收并执行一条指令
+func (s *Simulator) WriteCharacteristic(data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.connected {
+		return fmt.Errorf("设备未连接")
+	}
+	if len(data) == 0 {
+		return fmt.Errorf("空指令")
+	}
+
+	s.drainBattery()
+
+	switch data[0] {
+	case 0xB0:
+		return s.handleB0(data)
+	case 0xBF:
+		return s.handleBF(data)
+	default:
+		return fmt.Errorf("未知指令: 0x%02X", data[0])
+	}
+}
+
+// handleB0 处理B0指令：更新强度并记录波形
+func (s *Simulator) handleB0(data []byte) error {
+	cmd, err := protocol.ParseB0Command(data)
+	if err != nil {
+		return err
+	}
+
+	oldA, oldB := s.aStrength, s.bStrength
+	s.aStrength = applyStrength(s.aStrength, cmd.AMode, cmd.AStrength, s.aLimit)
+	s.bStrength = applyStrength(s.bStrength, cmd.BMode, cmd.BStrength, s.bLimit)
+	s.aWave = cmd.AWaveData
+	s.bWave = cmd.BWaveData
+
+	s.frames++
+	if s.frames%100 == 0 {
+		log.Printf("模拟设备: 已播放%d帧，A=%d B=%d", s.frames, s.aStrength, s.bStrength)
+	}
+
+	// 带序列号的指令或强度发生变化时，设备回应B1消息
+	if cmd.Sequence != 0 || oldA != s.aStrength || oldB != s.bStrength {
+		s.emitStrength(cmd.Sequence)
+	}
+	return nil
+}
+
+// handleBF 处理BF指令：设置通道软上限
+func (s *Simulator) handleBF(data []byte) error {
+	cmd, err := protocol.ParseBFCommand(data)
+	if err != nil {
+		return err
+	}
+
+	s.aLimit = int(protocol.ValidateStrength(int(cmd.ALimit)))
+	s.bLimit = int(protocol.ValidateStrength(int(cmd.BLimit)))
+
+	oldA, oldB := s.aStrength, s.bStrength
+	if s.aStrength > s.aLimit {
+		s.aStrength = s.aLimit
+	}
+	if s.bStrength > s.bLimit {
+		s.bStrength = s.bLimit
+	}
+	log.Printf("模拟设备: 软上限 A=%d B=%d 频率平衡 A=%d B=%d 强度平衡 A=%d B=%d",
+		s.aLimit, s.bLimit, cmd.AFrequencyBalance, cmd.BFrequencyBalance,
+		cmd.AIntensityBalance, cmd.BIntensityBalance)
+
+	if oldA != s.aStrength || oldB != s.bStrength {
+		s.emitStrength(0)
+	}
+	return nil
+}
+
+// applyStrength 按强度解读方式计算新强度，并限制在软上限内
+func applyStrength(current int, mode protocol.StrengthMode, value byte, limit int) int {
+	switch mode {
+	case protocol.StrengthModeIncrease:
+		current += int(value)
+	case protocol.StrengthModeDecrease:
+		current -= int(value)
+	case protocol.StrengthModeAbsolute:
+		current = int(value)
+	}
+
+	if current < 0 {
+		current = 0
+	}
+	if current > limit {
+		current = limit
+	}
+	return current
+}
+
+// drainBattery 根据有输出的时间模拟电量消耗，调用方需持有锁
+func (s *Simulator) drainBattery() {
+	now := time.Now()
+	if s.aStrength > 0 || s.bStrength > 0 {
+		s.outputFor += now.Sub(s.lastWrite)
+	}
+	s.lastWrite = now
+
+	drained := false
+	for s.outputFor >= batteryDrainInterval && s.battery > 0 {
+		s.outputFor -= batteryDrainInterval
+		s.battery--
+		drained = true
+	}
+	if drained {
+		s.publishBattery()
+	}
+}
+
+// publishBattery 上报当前电量，通道满时丢弃最旧的值，调用方需持有锁
+func (s *Simulator) publishBattery() {
+	for {
+		select {
+		case s.batteryCh <- s.battery:
+			return
+		default:
+		}
+		select {
+		case <-s.batteryCh:
+		default:
+		}
+	}
+}
+
+// emitStrength 以B1消息回报当前强度，调用方需持有锁
+func (s *Simulator) emitStrength(sequence byte) {
+	resp := protocol.B1Response{
+		Sequence:  sequence,
+		AStrength: byte(s.aStrength),
+		BStrength: byte(s.bStrength),
+	}
+	s.emit(resp.ToBytes())
+}
+
+// emit 发送一条通知消息，通道满时丢弃，调用方需持有锁
+func (s *Simulator) emit(msg []byte) {
+	select {
+	case s.notify <- msg:
+	default:
+		log.Printf("模拟设备: 通知通道已满，丢弃消息 %x", msg)
+	}
+}
+
+// Notifications 返回设备通知消息通道
+func (s *Simulator) Notifications() <-chan []byte {
+	return s.notify
+}
+
+// BatteryLevel 返回模拟电量
+func (s *Simulator) BatteryLevel() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.connected {
+		return 0, fmt.Errorf("设备未连接")
+	}
+	return s.battery, nil
+}
+
+// BatteryUpdates 返回电量变化通道
+func (s *Simulator) BatteryUpdates() <-chan int {
+	return s.batteryCh
+}
+
+// IsConnected 检查连接状态
+func (s *Simulator) IsConnected() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.connected
+}
+
+// Disconnect 断开模拟连接，强度归零
+func (s *Simulator) Disconnect() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.connected = false
+	s.aStrength, s.bStrength = 0, 0
+	return nil
+}
@@ -0,0 +1,30 @@
+package transport
+
+import "time"
+
+// Transport 设备通信传输层接口
+// 控制器只通过该接口与设备交互，真实蓝牙适配器和模拟设备都实现了它
+type Transport interface {
+	// Enable 启用传输层（如打开蓝牙适配器）
+	Enable() error
+	// ScanAndConnect 扫描并连接到目标设备
+	ScanAndConnect(timeout time.Duration, deviceNames []string) error
+	// WriteCharacteristic 向设备写入一条指令
+	WriteCharacteristic(data []byte) error
+	// Notifications 返回设备通知消息通道（如B1回应）
+	Notifications() <-chan []byte
+	// BatteryLevel 读取设备电量百分比
+	BatteryLevel() (int, error)
+	// BatteryUpdates 返回电量变化通道（连接时的读取和设备主动上报）
+	BatteryUpdates() <-chan int
+	// IsConnected 检查连接状态
+	IsConnected() bool
+	// Disconnect 断开连接
+	Disconnect() error
+}
+
+// 传输层类型
+const (
+	TypeBluetooth = "bluetooth" // 真实蓝牙设备
+	TypeSimulator = "simulator" // 内存模拟设备
+)
@@ -2,20 +2,44 @@ package main
 
 import (
 	"bufio"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"mygodblab/internal/config"
 	"mygodblab/internal/coyote"
 	"mygodblab/internal/mcp"
+	"mygodblab/internal/scene"
+	"mygodblab/internal/transport"
 )
 
 func main() {
+	simulate := flag.Bool("simulate", false, "使用内存模拟设备代替蓝牙设备")
+	mode := flag.String("mode", "http", "服务模式: http(HTTP服务器) 或 stdio(通过标准输入输出提供MCP服务，由MCP客户端启动)")
+	console := flag.Bool("console", false, "HTTP模式下同时从标准输入读取控制台命令（stop、rearm、场景等）")
+	flag.Parse()
+
+	// stdio模式下标准输出只用于MCP消息，其他输出都改写到标准错误（log默认已写入标准错误）
+	protocolOut := os.Stdout
+	switch *mode {
+	case "http":
+	case "stdio":
+		if *console {
+			log.Fatalf("stdio模式下标准输入用于MCP消息，不能同时启用控制台")
+		}
+		os.Stdout = os.Stderr
+	default:
+		log.Fatalf("无效的服务模式: %s（可选 http、stdio）", *mode)
+	}
+
 	fmt.Println("郊狼蓝牙控制器 v1.0.0")
 	fmt.Println("基于DG-LAB V3协议")
 
@@ -25,6 +49,9 @@ func main() {
 		log.Printf("加载配置失败，使用默认配置: %v", err)
 		cfg = config.DefaultConfig()
 	}
+	if *simulate {
+		cfg.Transport.Type = transport.TypeSimulator
+	}
 
 	// 创建郊狼控制器
 	controller, err := coyote.NewController(cfg)
@@ -33,30 +60,196 @@ func main() {
 	}
 	defer controller.Close()
 
-	// 启动蓝牙连接（在后台进行，不阻塞服务器启动）
+	// 启动连接监管（在后台扫描连接并在断线后自动重连，不阻塞服务器启动）
+	fmt.Println("正在扫描郊狼设备...")
+	controller.Start()
+
+	// 创建MCP服务
+	service := mcp.NewService(controller)
+	handler := mcp.NewHandler(service, cfg.MCP)
+
+	// 收到SIGINT/SIGTERM时先急停再退出
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
 	go func() {
-		fmt.Println("正在扫描郊狼设备...")
-		err = controller.ScanAndConnect(30 * time.Second)
-		if err != nil {
-			log.Printf("连接设备失败: %v", err)
-			fmt.Println("设备未连接，但HTTP服务器仍可使用")
-		} else {
-			fmt.Println("设备连接成功！")
+		sig := <-sigCh
+		log.Printf("收到信号 %v，执行急停并退出", sig)
+		if err := controller.EmergencyStop("收到信号 " + sig.String()); err != nil {
+			log.Printf("%v", err)
 		}
+		controller.Close()
+		os.Exit(0)
 	}()
 
-	// 创建MCP服务
-	service := mcp.NewService(controller)
-	handler := mcp.NewHandler(service)
+	if *mode == "stdio" {
+		log.Println("通过stdio提供MCP服务")
+		if err := handler.ServeStdio(os.Stdin, protocolOut); err != nil {
+			log.Printf("读取标准输入失败: %v", err)
+		}
+		// 客户端关闭连接后不再有人控制设备，先急停再退出
+		if err := controller.EmergencyStop("MCP客户端已断开"); err != nil {
+			log.Printf("%v", err)
+		}
+		return
+	}
 
 	// 设置HTTP路由
 	http.HandleFunc("/api/mcp", handler.HandleRequest)
+	http.HandleFunc("/sse", handler.HandleSSE)
+	http.HandleFunc("/messages", handler.HandleMessage)
+	http.HandleFunc("/api/estop", emergencyStopHandler(controller))
+	http.HandleFunc("/api/lease", leaseHandler(service))
+	http.HandleFunc("/api/fire", fireHandler(service))
 
 	// 启动HTTP服务器
 	serverAddr := ":8080"
 	fmt.Printf("MCP服务器启动在 http://localhost%s\n", serverAddr)
 	fmt.Println("API端点: http://localhost:8080/api/mcp")
-	log.Fatal(http.ListenAndServe(serverAddr, nil))
+	fmt.Println("旧版SSE端点: http://localhost:8080/sse")
+	fmt.Println("急停端点: POST http://localhost:8080/api/estop")
+	fmt.Println("租约端点: http://localhost:8080/api/lease")
+	fmt.Println("叠加端点: http://localhost:8080/api/fire")
+	if !*console {
+		log.Fatal(http.ListenAndServe(serverAddr, nil))
+	}
+
+	go func() {
+		log.Fatal(http.ListenAndServe(serverAddr, nil))
+	}()
+	runInteractiveMode(controller)
+	// 控制台退出（quit或标准输入关闭）后程序结束，先急停保证输出归零
+	if err := controller.EmergencyStop("控制台退出"); err != nil {
+		log.Printf("%v", err)
+	}
+}
+
+// emergencyStopHandler 急停HTTP端点：POST触发急停（可带reason参数），GET查询急停状态
+// 独立于MCP协议，便于脚本、硬件按钮等直接调用
+func emergencyStopHandler(controller *coyote.Controller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !mcp.LocalOrigin(r.Header.Get("Origin")) {
+			http.Error(w, "Origin not allowed", http.StatusForbidden)
+			return
+		}
+
+		var stopErr error
+		switch r.Method {
+		case http.MethodPost:
+			reason := r.URL.Query().Get("reason")
+			if reason == "" {
+				reason = "HTTP急停端点"
+			}
+			stopErr = controller.EmergencyStop(reason)
+		case http.MethodGet:
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		status := controller.StopStatus()
+		result := map[string]interface{}{
+			"stopped": status.Stopped,
+			"reason":  status.Reason,
+		}
+		if stopErr != nil {
+			result["error"] = stopErr.Error()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}
+}
+
+// leaseHandler 控制租约HTTP端点，供无法使用MCP的客户端做心跳
+// POST ?holder=&ttl= 打开租约，PUT ?lease_id= 续约，DELETE ?lease_id= 释放，GET 查询状态
+func leaseHandler(service *mcp.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !mcp.LocalOrigin(r.Header.Get("Origin")) {
+			http.Error(w, "Origin not allowed", http.StatusForbidden)
+			return
+		}
+		query := r.URL.Query()
+
+		var result interface{}
+		var err error
+		switch r.Method {
+		case http.MethodPost:
+			var seconds float64
+			if ttl := query.Get("ttl"); ttl != "" {
+				seconds, err = strconv.ParseFloat(ttl, 64)
+				if err != nil {
+					http.Error(w, "无效的ttl: "+ttl, http.StatusBadRequest)
+					return
+				}
+			}
+			result, err = service.OpenLease(query.Get("holder"), time.Duration(seconds*float64(time.Second)))
+		case http.MethodPut:
+			result, err = service.RenewLease(query.Get("lease_id"))
+		case http.MethodDelete:
+			err = service.ReleaseLease(query.Get("lease_id"))
+			result = map[string]bool{"released": err == nil}
+		case http.MethodGet:
+			result = service.GetStatus().Lease
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}
+}
+
+// fireHandler 临时叠加HTTP端点
+// POST ?channel=&delta=&duration=&pulse_id= 叠加，DELETE ?channel= 结束叠加，GET 查询正在生效的叠加
+func fireHandler(service *mcp.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !mcp.LocalOrigin(r.Header.Get("Origin")) {
+			http.Error(w, "Origin not allowed", http.StatusForbidden)
+			return
+		}
+		query := r.URL.Query()
+
+		var result interface{}
+		var err error
+		switch r.Method {
+		case http.MethodPost:
+			delta, convErr := strconv.Atoi(query.Get("delta"))
+			if convErr != nil {
+				http.Error(w, "无效的delta: "+query.Get("delta"), http.StatusBadRequest)
+				return
+			}
+			seconds, convErr := strconv.ParseFloat(query.Get("duration"), 64)
+			if convErr != nil {
+				http.Error(w, "无效的duration: "+query.Get("duration"), http.StatusBadRequest)
+				return
+			}
+			// 超过舒适阈值的叠加需要用户确认，HTTP端点无法确认，由策略拒绝
+			caller := coyote.Caller{Client: mcp.ClientID(r)}
+			var fired coyote.FireResult
+			fired, err = service.Fire(caller, query.Get("channel"), delta, query.Get("pulse_id"),
+				time.Duration(seconds*float64(time.Second)))
+			result = map[string]interface{}{"id": fired.ID, "result": fired.String()}
+		case http.MethodDelete:
+			err = service.CancelFire(query.Get("channel"))
+			result = map[string]bool{"cancelled": err == nil}
+		case http.MethodGet:
+			result = service.Fires()
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}
 }
 
 func runInteractiveMode(controller *coyote.Controller) {
@@ -64,9 +257,20 @@ func runInteractiveMode(controller *coyote.Controller) {
 	fmt.Println("  set-strength <channel> <value>  - 设置通道强度 (0-200)")
 	fmt.Println("  add-strength <channel> <value>  - 增加通道强度")
 	fmt.Println("  sub-strength <channel> <value>  - 减少通道强度")
+	fmt.Println("  ramp <channel> <value> <seconds> [curve] - 强度渐变到目标值")
 	fmt.Println("  set-limit <channel> <value>     - 设置通道强度上限")
-	fmt.Println("  set-pulse <pulse_id>            - 更换波形")
+	fmt.Println("  set-pulse [channel] <pulse_id>  - 更换波形（不指定通道时两个通道同时更换）")
+	fmt.Println("  fire <channel> <delta> <seconds> [pulse_id] - 临时叠加强度和波形，到期后恢复")
+	fmt.Println("  cancel-fire [channel]           - 立即结束临时叠加")
+	fmt.Println("  enable <channel>                - 启用通道")
+	fmt.Println("  disable <channel>               - 禁用通道（强度归零）")
+	fmt.Println("  stop                            - 急停（强度归零并锁定）")
+	fmt.Println("  rearm                           - 解除急停")
 	fmt.Println("  list-pulses                     - 列出可用波形")
+	fmt.Println("  save-scene <name>               - 将当前输出配置保存为场景")
+	fmt.Println("  load-scene <name>               - 加载场景（强度渐变到场景值）")
+	fmt.Println("  list-scenes                     - 列出已保存的场景")
+	fmt.Println("  delete-scene <name>             - 删除场景")
 	fmt.Println("  status                          - 显示当前状态")
 	fmt.Println("  help                            - 显示帮助信息")
 	fmt.Println("  quit                            - 退出程序")
@@ -92,6 +296,14 @@ func runInteractiveMode(controller *coyote.Controller) {
 		case "quit", "exit":
 			fmt.Println("再见！")
 			return
+		case "stop":
+			if err := controller.EmergencyStop("控制台stop命令"); err != nil {
+				fmt.Printf("急停: %v\n", err)
+			}
+		case "rearm":
+			if err := controller.Rearm(); err != nil {
+				fmt.Printf("解除急停失败: %v\n", err)
+			}
 		case "status":
 			controller.PrintStatus()
 		case "list-pulses":
@@ -104,10 +316,22 @@ func runInteractiveMode(controller *coyote.Controller) {
 			handleAddStrength(controller, parts)
 		case "sub-strength":
 			handleSubStrength(controller, parts)
+		case "ramp":
+			handleRamp(controller, parts)
 		case "set-limit":
 			handleSetLimit(controller, parts)
 		case "set-pulse":
 			handleSetPulse(controller, parts)
+		case "fire":
+			handleFire(controller, parts)
+		case "cancel-fire":
+			handleCancelFire(controller, parts)
+		case "enable", "disable":
+			handleChannelEnabled(controller, parts)
+		case "save-scene", "load-scene", "delete-scene":
+			handleScene(controller, parts)
+		case "list-scenes":
+			listScenes(controller)
 		default:
 			fmt.Printf("未知命令: %s，输入 'help' 查看帮助\n", cmd)
 		}
@@ -128,19 +352,14 @@ func handleSetStrength(controller *coyote.Controller, parts []string) {
 		return
 	}
 
-	// 创建定时器，每100ms发送一次指令
-	ticker := time.NewTicker(100 * time.Millisecond)
-	defer ticker.Stop()
-
-	fmt.Printf("开始持续输出到%s通道，强度为%d（按Ctrl+C停止）\n", channel, value)
-
-	// 持续发送指令
-	for range ticker.C {
-		err = controller.SetStrength(channel, value)
-		if err != nil {
-			fmt.Printf("设置强度失败: %v\n", err)
-			return
-		}
+	// 强度变更由控制器的播放循环随下一帧波形发送
+	result, err := controller.SetStrength(coyote.ConsoleCaller, channel, value)
+	if err != nil {
+		fmt.Printf("设置强度失败: %v\n", err)
+		return
+	}
+	if result.Adjusted() {
+		fmt.Println(result)
 	}
 }
 
@@ -158,9 +377,13 @@ func handleAddStrength(controller *coyote.Controller, parts []string) {
 		return
 	}
 
-	err = controller.AddStrength(channel, value) //TODO:NOTICE 增加强度
+	result, err := controller.AddStrength(coyote.ConsoleCaller, channel, value) //TODO:NOTICE 增加强度
 	if err != nil {
 		fmt.Printf("增加强度失败: %v\n", err)
+		return
+	}
+	if result.Adjusted() {
+		fmt.Println(result)
 	}
 }
 
@@ -178,12 +401,51 @@ func handleSubStrength(controller *coyote.Controller, parts []string) {
 		return
 	}
 
-	err = controller.SubStrength(channel, value)
+	_, err = controller.SubStrength(coyote.ConsoleCaller, channel, value)
 	if err != nil {
 		fmt.Printf("减少强度失败: %v\n", err)
 	}
 }
 
+func handleRamp(controller *coyote.Controller, parts []string) {
+	if len(parts) != 4 && len(parts) != 5 {
+		fmt.Println("用法: ramp <channel> <value> <seconds> [curve]")
+		fmt.Println("示例: ramp A 60 10 ease-in")
+		return
+	}
+
+	channel := parts[1]
+	value, err := strconv.Atoi(parts[2])
+	if err != nil {
+		fmt.Printf("无效的强度值: %s\n", parts[2])
+		return
+	}
+	seconds, err := strconv.ParseFloat(parts[3], 64)
+	if err != nil || seconds < 0 {
+		fmt.Printf("无效的渐变时间: %s\n", parts[3])
+		return
+	}
+	var curveName string
+	if len(parts) == 5 {
+		curveName = parts[4]
+	}
+	curve, err := coyote.ParseRampCurve(curveName)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return
+	}
+
+	duration := time.Duration(seconds * float64(time.Second))
+	result, err := controller.RampStrength(coyote.ConsoleCaller, channel, value, duration, curve)
+	if err != nil {
+		fmt.Printf("强度渐变失败: %v\n", err)
+		return
+	}
+	if result.Adjusted() {
+		fmt.Println(result)
+	}
+}
+
 func handleSetLimit(controller *coyote.Controller, parts []string) {
 	if len(parts) != 3 {
 		fmt.Println("用法: set-limit <channel> <value>")
@@ -205,20 +467,142 @@ func handleSetLimit(controller *coyote.Controller, parts []string) {
 }
 
 func handleSetPulse(controller *coyote.Controller, parts []string) {
-	if len(parts) != 2 {
-		fmt.Println("用法: set-pulse <pulse_id>")
-		fmt.Println("示例: set-pulse 7eae1e5f")
+	var channel, pulseID string
+	switch len(parts) {
+	case 2:
+		pulseID = parts[1]
+	case 3:
+		channel, pulseID = parts[1], parts[2]
+	default:
+		fmt.Println("用法: set-pulse [channel] <pulse_id>")
+		fmt.Println("示例: set-pulse 7eae1e5f 或 set-pulse B eea0e4ce")
 		fmt.Println("使用 'list-pulses' 查看可用波形")
 		return
 	}
 
-	pulseID := parts[1]
-	err := controller.SetPulse(pulseID)
+	err := controller.SetPulse(channel, pulseID)
 	if err != nil {
 		fmt.Printf("设置波形失败: %v\n", err)
 	}
 }
 
+func handleFire(controller *coyote.Controller, parts []string) {
+	if len(parts) != 4 && len(parts) != 5 {
+		fmt.Println("用法: fire <channel> <delta> <seconds> [pulse_id]")
+		fmt.Println("示例: fire A 20 3 eea0e4ce")
+		return
+	}
+
+	channel := parts[1]
+	delta, err := strconv.Atoi(parts[2])
+	if err != nil {
+		fmt.Printf("无效的强度增量: %s\n", parts[2])
+		return
+	}
+	seconds, err := strconv.ParseFloat(parts[3], 64)
+	if err != nil || seconds <= 0 {
+		fmt.Printf("无效的持续时间: %s\n", parts[3])
+		return
+	}
+	var pulseID string
+	if len(parts) == 5 {
+		pulseID = parts[4]
+	}
+
+	duration := time.Duration(seconds * float64(time.Second))
+	result, err := controller.Fire(coyote.ConsoleCaller, channel, delta, pulseID, duration)
+	if err != nil {
+		fmt.Printf("叠加失败: %v\n", err)
+		return
+	}
+	if result.Adjusted() {
+		fmt.Println(result)
+	}
+}
+
+func handleCancelFire(controller *coyote.Controller, parts []string) {
+	var channel string
+	switch len(parts) {
+	case 1:
+	case 2:
+		channel = parts[1]
+	default:
+		fmt.Println("用法: cancel-fire [channel]")
+		return
+	}
+
+	if err := controller.CancelFire(channel); err != nil {
+		fmt.Printf("结束叠加失败: %v\n", err)
+	}
+}
+
+func handleScene(controller *coyote.Controller, parts []string) {
+	if len(parts) != 2 {
+		fmt.Printf("用法: %s <name>\n", parts[0])
+		fmt.Printf("示例: %s warmup\n", parts[0])
+		return
+	}
+
+	name := parts[1]
+	switch parts[0] {
+	case "save-scene":
+		if _, err := controller.SaveScene(name); err != nil {
+			fmt.Printf("保存场景失败: %v\n", err)
+			return
+		}
+		fmt.Printf("场景%s已保存\n", name)
+	case "load-scene":
+		result, err := controller.LoadScene(coyote.ConsoleCaller, name)
+		if err != nil {
+			fmt.Printf("加载场景失败: %v\n", err)
+			return
+		}
+		fmt.Println(result)
+	case "delete-scene":
+		if err := controller.DeleteScene(name); err != nil {
+			fmt.Printf("删除场景失败: %v\n", err)
+		}
+	}
+}
+
+func listScenes(controller *coyote.Controller) {
+	scenes, err := controller.ListScenes()
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return
+	}
+	if len(scenes) == 0 {
+		fmt.Println("还没有保存的场景，使用 'save-scene <name>' 保存当前配置")
+		return
+	}
+
+	fmt.Println("\n=== 已保存的场景 ===")
+	for _, s := range scenes {
+		fmt.Printf("%s: A=%s B=%s\n", s.Name, sceneChannelText(s.AChannel), sceneChannelText(s.BChannel))
+	}
+}
+
+// sceneChannelText 控制台显示的场景通道配置
+func sceneChannelText(ch scene.Channel) string {
+	if !ch.Enabled {
+		return "禁用"
+	}
+	return fmt.Sprintf("%d/%d %s", ch.Strength, ch.Limit, ch.Pulse)
+}
+
+func handleChannelEnabled(controller *coyote.Controller, parts []string) {
+	if len(parts) != 2 {
+		fmt.Printf("用法: %s <channel>\n", parts[0])
+		fmt.Printf("示例: %s B\n", parts[0])
+		return
+	}
+
+	err := controller.SetChannelEnabled(parts[1], parts[0] == "enable")
+	if err != nil {
+		fmt.Printf("设置通道失败: %v\n", err)
+	}
+}
+
 func showHelp() {
 	fmt.Println("\n=== 命令帮助 ===")
 	fmt.Println("set-strength <channel> <value>  - 设置通道强度")
@@ -232,13 +616,38 @@ func showHelp() {
 	fmt.Println("sub-strength <channel> <value>  - 减少通道强度")
 	fmt.Println("  示例: sub-strength A 5")
 	fmt.Println()
+	fmt.Println("ramp <channel> <value> <seconds> [curve] - 强度渐变到目标值")
+	fmt.Println("  curve: linear(默认)、ease-in、exponential")
+	fmt.Println("  示例: ramp A 60 10 ease-in")
+	fmt.Println()
 	fmt.Println("set-limit <channel> <value>     - 设置通道强度上限")
 	fmt.Println("  示例: set-limit A 80")
 	fmt.Println()
-	fmt.Println("set-pulse <pulse_id>            - 更换波形")
+	fmt.Println("set-pulse [channel] <pulse_id>  - 更换波形")
+	fmt.Println("  channel: A 或 B，省略时两个通道同时更换")
 	fmt.Println("  示例: set-pulse 7eae1e5f")
+	fmt.Println("  示例: set-pulse B eea0e4ce")
 	fmt.Println("  使用 'list-pulses' 查看可用波形ID")
 	fmt.Println()
+	fmt.Println("fire <channel> <delta> <seconds> [pulse_id] - 临时叠加")
+	fmt.Println("  在基础强度上增加delta（可为负），指定波形时叠加期间临时播放该波形")
+	fmt.Println("  到期后恢复到届时的基础强度和波形，多个叠加可以重叠")
+	fmt.Println("  示例: fire A 20 3 eea0e4ce")
+	fmt.Println("cancel-fire [channel]           - 立即结束叠加，省略通道时结束两个通道")
+	fmt.Println()
+	fmt.Println("enable <channel>                - 启用通道")
+	fmt.Println("disable <channel>               - 禁用通道，强度归零且不再输出")
+	fmt.Println("  示例: disable B")
+	fmt.Println()
+	fmt.Println("stop                            - 急停：两个通道立即归零并锁定")
+	fmt.Println("rearm                           - 解除急停，强度从0开始")
+	fmt.Println()
+	fmt.Println("save-scene <name>               - 保存当前的启用状态、上限、强度和波形")
+	fmt.Println("load-scene <name>               - 加载场景，强度按 ramp.auto_rate 渐变并经过安全策略")
+	fmt.Println("list-scenes                     - 列出已保存的场景")
+	fmt.Println("delete-scene <name>             - 删除场景")
+	fmt.Println("  示例: save-scene warmup")
+	fmt.Println()
 	fmt.Println("list-pulses                     - 列出所有可用波形")
 	fmt.Println("status                          - 显示当前设备状态")
 	fmt.Println("help                            - 显示此帮助信息")
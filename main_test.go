@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"mygodblab/internal/config"
+	"mygodblab/internal/coyote"
+	"mygodblab/internal/mcp"
+	"mygodblab/internal/transport"
+)
+
+// newTestController 创建使用模拟设备的控制器，配置文件都指向不存在的临时路径
+func newTestController(t *testing.T) *coyote.Controller {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.Transport.Type = transport.TypeSimulator
+	cfg.Pulses.ConfigPath = filepath.Join(dir, "pulses.yaml")
+	cfg.Policy.ConfigPath = filepath.Join(dir, "policy.yaml")
+	cfg.Scenes.ConfigPath = filepath.Join(dir, "scenes.yaml")
+
+	controller, err := coyote.NewController(cfg)
+	if err != nil {
+		t.Fatalf("NewController() error = %v", err)
+	}
+	t.Cleanup(func() { controller.Close() })
+	return controller
+}
+
+func TestHTTPEndpointsRejectForeignOrigin(t *testing.T) {
+	controller := newTestController(t)
+	service := mcp.NewService(controller)
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		target  string
+	}{
+		{"急停", emergencyStopHandler(controller), "/api/estop"},
+		{"租约", leaseHandler(service), "/api/lease?holder=web"},
+		{"叠加", fireHandler(service), "/api/fire?channel=A&delta=20&duration=3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.target, nil)
+			req.Header.Set("Origin", "http://evil.example")
+			rec := httptest.NewRecorder()
+			tt.handler(rec, req)
+			if rec.Code != http.StatusForbidden {
+				t.Errorf("status = %d, want 403", rec.Code)
+			}
+		})
+	}
+
+	if controller.IsStopped() {
+		t.Error("外部来源的请求触发了急停")
+	}
+	if status := service.GetStatus(); status.Lease != nil || len(status.Fires) != 0 {
+		t.Errorf("外部来源的请求改变了状态: lease=%v fires=%v", status.Lease, status.Fires)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/estop", nil)
+	req.Header.Set("Origin", "http://localhost:3000")
+	rec := httptest.NewRecorder()
+	emergencyStopHandler(controller)(rec, req)
+	if rec.Code != http.StatusOK || !controller.IsStopped() {
+		t.Errorf("本机来源的急停 status = %d, stopped = %v", rec.Code, controller.IsStopped())
+	}
+}